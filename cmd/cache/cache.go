@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/cmd/cache/clean"
+	"github.com/selimacerbas/flow/cmd/cache/status"
+)
+
+type CacheSubCmds struct {
+	Status string
+	Clean  string
+}
+
+var args = &CacheSubCmds{
+	Status: "status",
+	Clean:  "clean",
+}
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache [operation]",
+	Short: "Inspect or clear the build cache",
+	ValidArgs: []string{
+		args.Status,
+		args.Clean,
+	},
+	Args: cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+}
+
+func init() {
+	CacheCmd.AddCommand(status.StatusCmd)
+	CacheCmd.AddCommand(clean.CleanCmd)
+}
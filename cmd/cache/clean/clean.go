@@ -0,0 +1,88 @@
+package clean
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/internal/cache"
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+type CleanCmdOptions struct {
+	CacheDir  string
+	OlderThan time.Duration
+	Output    string
+}
+
+var defaults = &CleanCmdOptions{
+	CacheDir:  "",
+	OlderThan: 0,
+	Output:    "text",
+}
+
+func init() {
+	d := defaults
+	f := CleanCmd.Flags()
+
+	f.StringVar(&d.CacheDir, "cache-dir", d.CacheDir, "Cache dir. Reads from config 'cache.dir' or FLOW_CACHE_DIR. Default: .flow/cache")
+	f.DurationVar(&d.OlderThan, "older-than", d.OlderThan, "Only remove entries older than this, e.g. 168h. Default: remove everything")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Plan format with --dry-run (text|json)")
+}
+
+var CleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove build cache entries",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		d := defaults
+
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
+		}
+
+		projectRoot, err := utils.DetectProjectRoot()
+		if err != nil {
+			log.Fatalf("failed to detect project root %v", err)
+		}
+		c := cache.New(cache.ResolveDir(projectRoot, d.CacheDir))
+
+		var cutoff time.Time
+		if d.OlderThan > 0 {
+			cutoff = time.Now().Add(-d.OlderThan)
+		}
+
+		if dryRun {
+			removes := []string{c.Dir}
+			if !cutoff.IsZero() {
+				stale, err := c.Stale(cutoff)
+				if err != nil {
+					log.Fatalf("failed to read cache: %v", err)
+				}
+				removes = removes[:0]
+				for _, e := range stale {
+					removes = append(removes, c.EntryDir(e.Key))
+				}
+			}
+			plan := &runner.Plan{}
+			plan.Add(context.Background(), runner.Step{Operation: "cache-clean", Removes: removes})
+			if err := runner.WritePlan(os.Stdout, plan, d.Output); err != nil {
+				log.Fatalf("failed to write plan: %v", err)
+			}
+			return
+		}
+
+		removed, err := c.Clean(cutoff)
+		if err != nil {
+			log.Fatalf("failed to clean cache: %v", err)
+		}
+		fmt.Printf("Removed %d cache entries from %s\n", removed, c.Dir)
+	},
+}
@@ -0,0 +1,115 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/internal/cache"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+type StatusCmdOptions struct {
+	CacheDir string
+	Output   string
+}
+
+var defaults = &StatusCmdOptions{
+	CacheDir: "",
+	Output:   "text",
+}
+
+type StatusCmdOutput struct {
+	Dir     string        `json:"dir"`
+	Remote  string        `json:"remote,omitempty"`
+	Entries []cache.Entry `json:"entries"`
+	Size    int64         `json:"size"`
+}
+
+func init() {
+	d := defaults
+	f := StatusCmd.Flags()
+
+	f.StringVar(&d.CacheDir, "cache-dir", d.CacheDir, "Cache dir. Reads from config 'cache.dir' or FLOW_CACHE_DIR. Default: .flow/cache")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Output format (text|json)")
+}
+
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the build cache entries and their size",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		d := defaults
+
+		projectRoot, err := utils.DetectProjectRoot()
+		if err != nil {
+			log.Fatalf("failed to detect project root %v", err)
+		}
+		c, err := cache.Open(projectRoot, d.CacheDir, "")
+		if err != nil {
+			log.Fatalf("failed to open build cache: %v", err)
+		}
+		entries, err := c.Entries()
+		if err != nil {
+			log.Fatalf("failed to read cache: %v", err)
+		}
+
+		out := StatusCmdOutput{Dir: c.Dir, Entries: entries}
+		if c.Remote != nil {
+			out.Remote = c.Remote.Backend.String()
+		}
+		if out.Entries == nil {
+			out.Entries = []cache.Entry{}
+		}
+		for _, e := range entries {
+			out.Size += e.Size
+		}
+
+		switch d.Output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(out); err != nil {
+				log.Fatalf("failed to encode json: %v", err)
+			}
+		case "text":
+			if len(entries) == 0 {
+				fmt.Printf("No cache entries in %s\n", c.Dir)
+				return
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "KEY\tTARGET\tOPERATION\tOUTPUTS\tSIZE\tAGE")
+			for _, e := range entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+					e.Key[:12], e.Target, e.Operation, len(e.Outputs), formatSize(e.Size), time.Since(e.Created).Round(time.Second))
+			}
+			if err := tw.Flush(); err != nil {
+				log.Fatalf("failed to write table: %v", err)
+			}
+			fmt.Printf("\n%d entries, %s in %s\n", len(entries), formatSize(out.Size), c.Dir)
+			if out.Remote != "" {
+				fmt.Printf("Remote: %s\n", out.Remote)
+			}
+		default:
+			log.Fatalf("invalid --output: %q (expected: text|json)", d.Output)
+		}
+	},
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,6 +1,7 @@
 package set
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,15 +11,19 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
 	"github.com/selimacerbas/flow/internal/utils"
 )
 
 type SetCmdOptions struct {
-	Bin string // CLI binary name or launcher: e.g. "flow", "./flow", "/usr/local/bin/flow", or "go run ."
+	Bin    string // CLI binary name or launcher: e.g. "flow", "./flow", "/usr/local/bin/flow", or "go run ."
+	Output string // plan format with --dry-run: text|json
 }
 
 var defaults = &SetCmdOptions{
-	Bin: "./flow",
+	Bin:    "./flow",
+	Output: "text",
 }
 
 var SetCmd = &cobra.Command{
@@ -32,11 +37,13 @@ var SetCmd = &cobra.Command{
 			log.Fatalf("failed to detect project root: %v", err)
 		}
 
-		hookPath := filepath.Join(root, ".git", "hooks", "commit-msg")
-		if err := os.MkdirAll(filepath.Dir(hookPath), 0o755); err != nil {
-			log.Fatalf("failed to ensure hooks dir: %v", err)
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
 		}
 
+		hookPath := filepath.Join(root, ".git", "hooks", "commit-msg")
+
 		var contents string
 
 		// If user wants to run via go, make sure we run in repo root (module context).
@@ -71,6 +78,18 @@ exec "%s" commit hook "$1"
 `, d.Bin, abs)
 		}
 
+		if dryRun {
+			plan := &runner.Plan{}
+			plan.Add(context.Background(), runner.Step{Operation: "commit-hook", Writes: []string{hookPath}})
+			if err := runner.WritePlan(os.Stdout, plan, d.Output); err != nil {
+				log.Fatalf("failed to write plan: %v", err)
+			}
+			return
+		}
+
+		if err := os.MkdirAll(filepath.Dir(hookPath), 0o755); err != nil {
+			log.Fatalf("failed to ensure hooks dir: %v", err)
+		}
 		if err := os.WriteFile(hookPath, []byte(contents), 0o755); err != nil {
 			log.Fatalf("failed to write commit-msg hook: %v", err)
 		}
@@ -82,5 +101,6 @@ exec "%s" commit hook "$1"
 func init() {
 	d := defaults
 	f := SetCmd.Flags()
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Plan format with --dry-run (text|json)")
 	f.StringVar(&d.Bin, "bin", d.Bin, "CLI binary or launcher invoked by the hook. Examples: 'flow', './flow', '/usr/local/bin/flow', or 'go run .'. Default: ./flow")
 }
@@ -0,0 +1,74 @@
+package baseref
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
+)
+
+type BaseRefCmdOptions struct {
+	Short  bool
+	Output string
+}
+
+var defaults = &BaseRefCmdOptions{
+	Short:  false,
+	Output: "text",
+}
+
+var BaseRefCmd = &cobra.Command{
+	Use:   "base-ref",
+	Short: "Print the base SHA to diff against, detected from the CI environment",
+	Long: `Detect the base and head commits of the current CI run.
+
+Reads FLOW_BASE_REF/FLOW_HEAD_REF first, then the GitHub Actions event payload
+(GITHUB_EVENT_PATH) for push, pull_request, merge_group and tag events, then
+GitLab CI variables. Outside CI it falls back to HEAD~1..HEAD.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		d := defaults
+
+		root, err := utils.DetectProjectRoot()
+		if err != nil {
+			log.Fatalf("failed to detect project root: %v", err)
+		}
+
+		refs, err := get.DetectCIRefs(root)
+		if err != nil {
+			log.Fatalf("failed to detect CI refs: %v", err)
+		}
+
+		if d.Short {
+			refs.Base = get.Shorten(refs.Base, 7)
+			refs.Head = get.Shorten(refs.Head, 7)
+		}
+
+		switch d.Output {
+		case "json":
+			if err := json.NewEncoder(os.Stdout).Encode(refs); err != nil {
+				log.Fatalf("failed to write json: %v", err)
+			}
+		case "text":
+			if refs.Note != "" {
+				fmt.Fprintln(os.Stderr, "→", refs.Note)
+			}
+			fmt.Println(refs.Base)
+		default:
+			log.Fatalf("invalid --output: %q (expected: text|json)", d.Output)
+		}
+	},
+}
+
+func init() {
+	d := defaults
+	f := BaseRefCmd.Flags()
+
+	f.BoolVar(&d.Short, "short", d.Short, "Print 7-character abbreviated SHAs")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Output format (text|json). Default: text")
+}
@@ -1,14 +1,21 @@
 package changed
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
 	"github.com/selimacerbas/flow/pkg/get"
 )
 
@@ -18,39 +25,186 @@ type ChangedCmdArgOptions struct {
 }
 
 type ChangedCmdFlagOptions struct {
-	Scope  string
-	Output string
+	Scope      string
+	Output     string
+	Invalidate []string
+	NoIgnore   bool
+	Explain    bool
+	Selector   string
+	Staged     bool
+	Worktree   bool
+	Untracked  bool
+	Auto       bool
+	GitHubOut  string
+
+	SinceLastSuccess bool
+	GitOwner         string
+	GitRepo          string
+	GitWorkflow      string
+	GitBranch        string
+	GitToken         string
+	Fallback         string
+	FallbackBranch   string
 }
 
 var flagOpts = &ChangedCmdFlagOptions{
-	Scope:  "",
-	Output: "",
+	Scope:      "",
+	Output:     "text",
+	Invalidate: []string{},
+	NoIgnore:   false,
+	Explain:    false,
+	Selector:   "",
+	Staged:     false,
+	Worktree:   false,
+	Untracked:  false,
+	Auto:       false,
+	GitHubOut:  "",
+
+	SinceLastSuccess: false,
+	GitOwner:         "",
+	GitRepo:          "",
+	GitWorkflow:      "",
+	GitBranch:        "",
+	GitToken:         "",
+	Fallback:         "",
+	FallbackBranch:   "",
 }
 
 type ChangedCmdOutput struct {
-	Functions []string `json:"functions,omitempty"`
-	Services  []string `json:"services,omitempty"`
+	Kinds   map[string][]string           `json:"kinds"`
+	Targets map[string]*get.ChangedTarget `json:"targets,omitempty"`
+	Explain map[string]*get.Explanation   `json:"explain,omitempty"`
+}
+
+// MatrixOutput is a GitHub Actions `strategy.matrix` ready for fromJSON.
+type MatrixOutput struct {
+	Include []MatrixEntry `json:"include"`
+}
+
+type MatrixEntry struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Status   string `json:"status"`
 }
 
 func init() {
 	o := flagOpts
 	f := ChangedCmd.Flags()
 
-	f.StringVar(&o.Scope, "scope", o.Scope, "Kind of target (function|service|all).")
-	f.StringVarP(&o.Output, "output", "o", o.Output, "Output format (text|json).")
+	f.StringVar(&o.Scope, "scope", o.Scope, "Kind(s) of target: a kind name from config, comma-separated names, or all.")
+	f.StringVarP(&o.Output, "output", "o", o.Output, "Output format (text|json|matrix). Default: text")
+	f.StringSliceVar(&o.Invalidate, "invalidate", o.Invalidate, "Glob(s) that mark every target as changed (e.g. go.work,.github/workflows/*). Reads from config 'invalidate'.")
+
+	f.BoolVar(&o.NoIgnore, "no-ignore", o.NoIgnore, "Don't apply 'ignore' config and .flowignore patterns.")
+	f.BoolVar(&o.Explain, "explain", o.Explain, "Show the rule and the changed files behind each target.")
+	f.StringVarP(&o.Selector, "selector", "l", o.Selector, "Only report targets whose labels match, e.g. 'team=payments,tier!=experimental'.")
+
+	f.BoolVar(&o.Staged, "staged", o.Staged, "Compare the ref (default HEAD) with the index instead of a second ref.")
+	f.BoolVar(&o.Worktree, "worktree", o.Worktree, "Compare the ref (default HEAD) with the working tree, staged and unstaged.")
+	f.BoolVar(&o.Untracked, "untracked", o.Untracked, "Also count untracked files. Implies --worktree unless --staged is set.")
+	f.BoolVar(&o.Auto, "auto", o.Auto, "Detect both refs from the CI environment (see 'flow get base-ref').")
+	f.StringVar(&o.GitHubOut, "github-output", o.GitHubOut, "Also write the matrix JSON under this key, plus any_changed, to $GITHUB_OUTPUT.")
+
+	f.BoolVar(&o.SinceLastSuccess, "since-last-success", o.SinceLastSuccess, "Use the head SHA of the last successful --git-workflow run on --git-branch as the first ref.")
+	f.StringVar(&o.GitOwner, "git-owner", o.GitOwner, "GitHub owner/org. Reads from config/env.")
+	f.StringVar(&o.GitRepo, "git-repo", o.GitRepo, "GitHub repository name. Reads from config/env.")
+	f.StringVar(&o.GitWorkflow, "git-workflow", o.GitWorkflow, "Workflow file name under .github/workflows (e.g., build.yaml).")
+	f.StringVar(&o.GitBranch, "git-branch", o.GitBranch, "Branch name to query. Reads from config/env.")
+	f.StringVar(&o.GitToken, "git-token", o.GitToken, "GitHub token. Reads from config/env.")
+	f.StringVar(&o.Fallback, "fallback", o.Fallback, "Base when no usable successful run exists: merge-base|all. Reads from config 'changed.fallback'.")
+	f.StringVar(&o.FallbackBranch, "fallback-branch", o.FallbackBranch, "Branch used by the merge-base fallback. Reads from config 'changed.fallback_branch'.")
+
+	_ = viper.BindPFlag("invalidate", f.Lookup("invalidate"))
 
 }
 
 var ChangedCmd = &cobra.Command{
-	Use:   "changed {branch|tag|ref|sha} {branch|tag|ref|sha}",
-	Short: "List top-level changed folders under functions/services.",
-	Args:  cobra.ExactArgs(2),
+	Use:   "changed {branch|tag|ref|sha} [{branch|tag|ref|sha}]",
+	Short: "List changed targets per kind, including those whose in-repo Go dependencies changed.",
+	Long: `List changed targets per kind between two refs.
+
+With --staged, --worktree or --untracked only the first ref is used (default
+HEAD) and it is compared with the index or the working tree instead. With
+--auto both refs are detected from the CI environment. With
+--since-last-success the first ref is the head of the last successful workflow
+run and the only argument, if any, is the second ref (default HEAD).`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		o := flagOpts
+		if o.Auto && o.SinceLastSuccess {
+			return fmt.Errorf("--auto and --since-last-success cannot be combined")
+		}
+		if o.Auto {
+			return cobra.NoArgs(cmd, args)
+		}
+		if o.SinceLastSuccess {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		if o.Staged || o.Worktree || o.Untracked {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		o := flagOpts
 
 		argOpts := &ChangedCmdArgOptions{
-			Ref1: args[0],
-			Ref2: args[1],
+			Ref1: "HEAD",
+		}
+		if len(args) > 0 {
+			argOpts.Ref1 = args[0]
+		}
+		if len(args) > 1 {
+			argOpts.Ref2 = args[1]
+		}
+		if o.Auto {
+			root, err := utils.DetectProjectRoot()
+			if err != nil {
+				log.Fatalf("failed to detect project root: %v", err)
+			}
+			refs, err := get.DetectCIRefs(root)
+			if err != nil {
+				log.Fatalf("failed to detect CI refs: %v", err)
+			}
+			if refs.Note != "" {
+				fmt.Fprintln(os.Stderr, "→", refs.Note)
+			}
+			fmt.Fprintf(os.Stderr, "→ Comparing %s..%s (%s)\n", get.Shorten(refs.Base, 7), get.Shorten(refs.Head, 7), refs.Provider)
+			argOpts.Ref1, argOpts.Ref2 = refs.Base, refs.Head
+		}
+		if o.SinceLastSuccess {
+			query := get.WorkflowQuery{
+				Owner:    common.ResolveGitOwner(o.GitOwner),
+				Repo:     common.ResolveGitRepo(o.GitRepo),
+				Workflow: common.ResolveGitWorkflow(o.GitWorkflow),
+				Branch:   common.ResolveGitBranch(o.GitBranch),
+				Token:    common.ResolveGitToken(o.GitToken),
+			}
+			if query.Owner == "" || query.Repo == "" || query.Workflow == "" || query.Branch == "" {
+				log.Fatalf("--git-owner, --git-repo, --git-workflow and --git-branch are required with --since-last-success (pass flags, config, or env)")
+			}
+
+			root, err := utils.DetectProjectRoot()
+			if err != nil {
+				log.Fatalf("failed to detect project root: %v", err)
+			}
+			head := "HEAD"
+			if len(args) > 0 {
+				head = args[0]
+			}
+			refs, err := get.ResolveLastSuccessRefs(root, head, query,
+				common.ResolveChangedFallback(o.Fallback),
+				common.ResolveChangedFallbackBranch(o.FallbackBranch),
+			)
+			if err != nil {
+				log.Fatalf("failed to resolve last successful run: %v", err)
+			}
+			if refs.Note != "" {
+				fmt.Fprintln(os.Stderr, "→", refs.Note)
+			}
+			fmt.Fprintf(os.Stderr, "→ Comparing %s..%s (%s)\n", get.Shorten(refs.Base, 7), get.Shorten(refs.Head, 7), refs.Provider)
+			argOpts.Ref1, argOpts.Ref2 = refs.Base, refs.Head
 		}
 
 		// read persistent flags defined higher up in your CLI
@@ -66,17 +220,48 @@ var ChangedCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("failed to get services-subdir flag: %v", err)
 		}
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
+		}
 
 		scope := common.ResolveScope(o.Scope)
 
-		result, err := get.GetChanged(argOpts.Ref1, argOpts.Ref2, scope, srcDir, funcSub, svcSub)
+		result, err := get.GetChanged(argOpts.Ref1, argOpts.Ref2, scope, srcDir, funcSub, svcSub, get.ChangedOptions{
+			NoIgnore:  o.NoIgnore,
+			Staged:    o.Staged,
+			Worktree:  o.Worktree,
+			Untracked: o.Untracked,
+			Selector:  o.Selector,
+		})
 		if err != nil {
 			log.Fatalf("failed to get changed: %v", err)
 		}
 
 		output := &ChangedCmdOutput{
-			Functions: result.Functions,
-			Services:  result.Services,
+			Kinds:   result.Kinds,
+			Targets: result.Targets,
+		}
+		if o.Explain {
+			output.Explain = result.Explain
+		}
+
+		// stdout carries the --output format, so the plan goes to stderr.
+		if o.GitHubOut != "" && dryRun {
+			plan := &runner.Plan{}
+			plan.Add(context.Background(), runner.Step{Operation: "github-output", Writes: []string{os.Getenv("GITHUB_OUTPUT")}})
+			if err := runner.WritePlan(os.Stderr, plan, "text"); err != nil {
+				log.Fatalf("failed to write plan: %v", err)
+			}
+		} else if o.GitHubOut != "" {
+			matrix, err := json.Marshal(buildMatrix(result))
+			if err != nil {
+				log.Fatalf("failed to encode matrix: %v", err)
+			}
+			anyChanged := strconv.FormatBool(len(result.Targets) > 0)
+			if err := utils.WriteGitHubOutput([2]string{o.GitHubOut, string(matrix)}, [2]string{"any_changed", anyChanged}); err != nil {
+				log.Fatalf("failed to write github output: %v", err)
+			}
 		}
 
 		switch o.Output {
@@ -85,15 +270,76 @@ var ChangedCmd = &cobra.Command{
 				log.Fatalf("failed to write json: %v", err)
 			}
 
+		case "matrix":
+			if err := json.NewEncoder(os.Stdout).Encode(buildMatrix(result)); err != nil {
+				log.Fatalf("failed to write matrix: %v", err)
+			}
+
 		case "text":
-			for _, name := range output.Functions {
-				fmt.Println(name)
+			kinds := make([]string, 0, len(output.Kinds))
+			for kind := range output.Kinds {
+				kinds = append(kinds, kind)
 			}
-			for _, name := range output.Services {
-				fmt.Println(name)
+			sort.Strings(kinds)
+			for _, kind := range kinds {
+				for _, name := range output.Kinds[kind] {
+					fmt.Println(name)
+					if o.Explain {
+						printExplanation(output.Targets[kind+"/"+name], output.Explain[kind+"/"+name])
+					}
+				}
 			}
 		default:
-			log.Fatalf("invalid --output: %q (expected: text|json)", o.Output)
+			log.Fatalf("invalid --output: %q (expected: text|json|matrix)", o.Output)
 		}
 	},
 }
+
+// buildMatrix lists every changed target, ordered by kind and name.
+func buildMatrix(result *get.ChangedOutput) *MatrixOutput {
+	root, _ := utils.DetectProjectRoot()
+
+	matrix := &MatrixOutput{Include: []MatrixEntry{}}
+	for _, t := range result.Targets {
+		dir := filepath.Join(root, filepath.FromSlash(t.Path))
+		language := utils.DetectLanguage(dir)
+		if m, err := common.LoadTargetManifest(dir); err == nil && m != nil && m.Language != "" {
+			language = m.Language
+		}
+		matrix.Include = append(matrix.Include, MatrixEntry{
+			Name:     t.Name,
+			Kind:     t.Kind,
+			Path:     t.Path,
+			Language: language,
+			Status:   t.Status,
+		})
+	}
+	sort.Slice(matrix.Include, func(i, j int) bool {
+		a, b := matrix.Include[i], matrix.Include[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return matrix
+}
+
+// printExplanation writes the status, rule and triggering files of a target
+// below its name.
+func printExplanation(t *get.ChangedTarget, e *get.Explanation) {
+	if t == nil || e == nil {
+		return
+	}
+	rule := e.Rule
+	if e.Pattern != "" {
+		rule = fmt.Sprintf("%s (%s)", rule, e.Pattern)
+	}
+	status := t.Status
+	if t.OldName != "" {
+		status = fmt.Sprintf("%s from %s", status, t.OldName)
+	}
+	fmt.Printf("  kind: %s, status: %s, rule: %s\n", t.Kind, status, rule)
+	for _, f := range e.Files {
+		fmt.Printf("    %s\n", f)
+	}
+}
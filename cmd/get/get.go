@@ -3,6 +3,7 @@ package get
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/selimacerbas/flow/cmd/get/baseref"
 	"github.com/selimacerbas/flow/cmd/get/changed"
 	"github.com/selimacerbas/flow/cmd/get/commitsha"
 	"github.com/selimacerbas/flow/cmd/get/mergebase"
@@ -13,12 +14,14 @@ type GetSubCmds struct {
 	Changed   string
 	CommitSHA string
 	MergeBase string
+	BaseRef   string
 }
 
 var args = &GetSubCmds{
 	Changed:   "changed",
 	CommitSHA: "commit-sha",
 	MergeBase: "merge-base",
+	BaseRef:   "base-ref",
 }
 
 var GetCmd = &cobra.Command{
@@ -28,6 +31,7 @@ var GetCmd = &cobra.Command{
 		args.Changed,
 		args.CommitSHA,
 		args.MergeBase,
+		args.BaseRef,
 	},
 	Args: cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
 }
@@ -37,5 +41,6 @@ func init() {
 	GetCmd.AddCommand(commitsha.CommitSHACmd)
 	GetCmd.AddCommand(mergebase.MergeBaseCmd)
 	GetCmd.AddCommand(workflowrunsha.WorkflowRunSHA)
+	GetCmd.AddCommand(baseref.BaseRefCmd)
 
 }
@@ -1,21 +1,15 @@
 package workflowrunsha
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
-	"strings"
-	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/selimacerbas/flow/internal/common"
-	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
 )
 
 type LatestSuccessfulWorkflowRunSHAOptions struct {
@@ -60,27 +54,9 @@ var WorkflowRunSHA = &cobra.Command{
 			log.Fatalf("--git-owner, --git-repo, --git-workflow and --git-branch are required (pass flags, config, or env)")
 		}
 
-		var run *runInfo
-		var err error
-		switch {
-		case token != "":
-			// Prefer HTTP when we have a token (works in CI & private repos)
-			run, err = fetchHTTP(owner, repo, workflow, branch, token)
-			if err != nil {
-				log.Fatalf("failed to fetch run info via HTTP %v", err)
-			}
-		case token == "" && utils.HasBin("gh"):
-			// Otherwise, try local gh CLI (uses user's gh auth & host config).
-			run, err = fetchViaGH(owner, repo, workflow, branch)
-			if err != nil {
-				log.Fatalf("failed to fetch run info via GH %v", err)
-			}
-		default:
-			// As a last resort, try unauthenticated HTTP (public repos only).
-			run, err = fetchHTTP(owner, repo, workflow, branch, "")
-			if err != nil {
-				log.Fatalf("failed to fetch run info via HTTP %v", err)
-			}
+		run, err := get.GetLastSuccessfulRun(owner, repo, workflow, branch, token)
+		if err != nil {
+			log.Fatalf("failed to fetch run info %v", err)
 		}
 
 		if run == nil {
@@ -111,87 +87,6 @@ var WorkflowRunSHA = &cobra.Command{
 	},
 }
 
-// ---- Fetchers ----
-type runInfo struct {
-	ID         int64     `json:"id"`
-	HeadSHA    string    `json:"head_sha"`
-	RunNumber  int       `json:"run_number"`
-	RunAttempt int       `json:"run_attempt"`
-	Status     string    `json:"status"`
-	Conclusion string    `json:"conclusion"`
-	Event      string    `json:"event"`
-	UpdatedAt  time.Time `json:"updated_at"`
-	HTMLURL    string    `json:"html_url"`
-}
-
-type ghListResp struct {
-	Runs []runInfo `json:"workflow_runs"`
-}
-
-func fetchHTTP(owner, repo, workflow, branch, token string) (*runInfo, error) {
-	u := fmt.Sprintf(
-		"https://api.github.com/repos/%s/%s/actions/workflows/%s/runs?branch=%s&status=success&exclude_pull_requests=true&per_page=1",
-		url.PathEscape(owner),
-		url.PathEscape(repo),
-		url.PathEscape(workflow),
-		url.QueryEscape(branch),
-	)
-
-	req, _ := http.NewRequest("GET", u, nil)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("github api request failed: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// Note: private repos without token intentionally return 404
-		return nil, fmt.Errorf("github api: %s (check owner/repo/workflow name/token)", resp.Status)
-	}
-
-	var out ghListResp
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, fmt.Errorf("decode github response: %w", err)
-	}
-	if len(out.Runs) == 0 {
-		return nil, nil
-	}
-	return &out.Runs[0], nil
-}
-
-func fetchViaGH(owner, repo, workflow, branch string) (*runInfo, error) {
-	args := []string{
-		"api",
-		fmt.Sprintf("repos/%s/%s/actions/workflows/%s/runs", owner, repo, workflow),
-		"--method", "GET", // keep it GET; otherwise -f/-F would POST and 404
-		"-H", "X-GitHub-Api-Version: 2022-11-28",
-		"-F", "branch=" + branch,
-		"-F", "status=success",
-		"-F", "exclude_pull_requests=true",
-		"-F", "per_page=1",
-	}
-	cmd := exec.Command("gh", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("gh api failed: %v: %s", err, strings.TrimSpace(stderr.String()))
-	}
-
-	var out ghListResp
-	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
-		return nil, fmt.Errorf("decode gh api response: %w", err)
-	}
-	if len(out.Runs) == 0 {
-		return nil, nil
-	}
-	return &out.Runs[0], nil
-}
-
 // func fetchViaGH(owner, repo, workflow, branch string) (*runInfo, error) {
 // 	// Use the repo-wide endpoint + query string so it's a GET (matches your working shell cmd)
 // 	endpoint := fmt.Sprintf(
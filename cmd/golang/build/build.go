@@ -1,18 +1,24 @@
 package build
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/selimacerbas/flow/internal/cache"
 	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
 	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
 )
 
 type BuildCmdOptions struct {
@@ -20,7 +26,17 @@ type BuildCmdOptions struct {
 	ImageTag         string
 	ImageRepository  string
 	ImageBuildMethod string
+	ImageNameInPath  bool
 	Targets          []string
+	Selector         string
+	ChangedBetween   []string
+	Jobs             int
+	KeepGoing        bool
+	Timeout          time.Duration
+	TargetTimeout    time.Duration
+	Output           string
+	NoCache          bool
+	CacheRemote      string
 	CustomCommand    string
 	CloudProvider    string
 	GCPRegion        string
@@ -35,7 +51,17 @@ var defaults = &BuildCmdOptions{
 	ImageTag:         "",
 	ImageRepository:  "",
 	ImageBuildMethod: "",
+	ImageNameInPath:  false,
 	Targets:          []string{},
+	Selector:         "",
+	ChangedBetween:   []string{},
+	Jobs:             0,
+	KeepGoing:        false,
+	Timeout:          0,
+	TargetTimeout:    0,
+	Output:           "text",
+	NoCache:          false,
+	CacheRemote:      "",
 	CustomCommand:    "",
 	CloudProvider:    "",
 	GCPRegion:        "",
@@ -49,13 +75,23 @@ func init() {
 	d := defaults
 	f := BuildCmd.Flags()
 
-    f.StringVar(&d.Scope, "scope", d.Scope, "Kind of target (function|service)")
+    f.StringVar(&d.Scope, "scope", d.Scope, "Kind(s) of target: a kind name from config, comma-separated names, or all")
 	// image settings
     f.StringVar(&d.ImageTag, "image-tag", d.ImageTag, "Image tag to apply when building/pushing")
     f.StringVar(&d.ImageRepository, "image-repository", d.ImageRepository, "Repository name (without registry host)")
     f.StringVar(&d.ImageBuildMethod, "image-build-method", d.ImageBuildMethod, "Build method: local|docker|cloud-build")
+    f.BoolVar(&d.ImageNameInPath, "image-name-in-path", d.ImageNameInPath, "aws/azure: push each target to <repository>/<image name> instead of the shared repository. Reads from config 'image.name_in_path'")
 	// targets & custom command
     f.StringSliceVarP(&d.Targets, "targets", "t", d.Targets, "Target service names. Repeat or comma-separate.")
+    f.StringVarP(&d.Selector, "selector", "l", d.Selector, "Label selector, e.g. 'team=payments,tier!=experimental' or 'tier in (critical,high)'")
+    f.IntVarP(&d.Jobs, "jobs", "j", d.Jobs, "Number of targets to build at once. Reads from config 'jobs'. Default: CPU count")
+    f.BoolVar(&d.KeepGoing, "keep-going", d.KeepGoing, "Build every target even if some fail, then print a summary and exit non-zero on failure")
+    f.DurationVar(&d.Timeout, "timeout", d.Timeout, "Stop everything still running after this long, e.g. 30m. Reads from config 'timeout'")
+    f.DurationVar(&d.TargetTimeout, "target-timeout", d.TargetTimeout, "Stop each target's operation after this long, e.g. 10m. Reads from config 'target_timeout'; a target manifest 'timeout' wins")
+    f.StringVarP(&d.Output, "output", "o", d.Output, "Summary format (text|json). json implies a summary and moves command output to stderr")
+    f.BoolVar(&d.NoCache, "no-cache", d.NoCache, "Always build, ignoring and not filling the build cache (.flow/cache, config 'cache.dir')")
+    f.StringVar(&d.CacheRemote, "cache-remote", d.CacheRemote, "Shared build cache: http(s) URL or dir. Reads from config 'cache.remote' or FLOW_CACHE_REMOTE")
+    f.StringSliceVar(&d.ChangedBetween, "changed-between", d.ChangedBetween, "Only targets changed between two refs: A..B, A,B or the flag repeated")
     f.StringVarP(&d.CustomCommand, "command", "c", "", "Custom go command(s) to run in each target (e.g., 'go clean ./... && go build'). Must start with 'go '.")
 
 	// cloud provider settings
@@ -100,33 +136,52 @@ var BuildCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("failed to get service-subdir flag: %v", err)
 		}
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
+		}
 
 		projectRoot, err := utils.DetectProjectRoot()
 		if err != nil {
 			log.Fatalf("failed to detect project root %v", err)
 		}
 
-		srcDir = common.ResolveSrcDir(srcDir)
 		scope := common.ResolveScope(d.Scope)
-		var subDir string
-
-		switch scope {
-		case "function":
-			subDir = common.ResolveFunctionsDir(subFuncDir)
-
-		case "service":
-			subDir = common.ResolveServicesDir(subSvcDir)
+		kinds, err := common.ResolveScopeKinds(scope, srcDir, subFuncDir, subSvcDir)
+		if err != nil {
+			log.Fatalf("failed to resolve kinds for scope %q: %v", scope, err)
 		}
-
-		absPath := utils.FormAbsolutePathToDir(projectRoot, srcDir, subDir)
-		targetAbsPaths, err := utils.FormAbsolutePathToTargetDirs(absPath, d.Targets)
+		targets, err := common.ResolveKindTargets(projectRoot, kinds, d.Targets)
 
 		if err != nil {
 			log.Fatalf("failed to form absolute path to %s targets %v", scope, err)
 		}
+		if targets, err = common.FilterTargets(targets, d.Selector); err != nil {
+			log.Fatalf("failed to apply --selector: %v", err)
+		}
+		if len(d.ChangedBetween) > 0 {
+			ref1, ref2, err := get.ParseRefRange(d.ChangedBetween)
+			if err != nil {
+				log.Fatalf("invalid --changed-between: %v", err)
+			}
+			if targets, err = get.FilterChanged(targets, ref1, ref2, scope, srcDir, subFuncDir, subSvcDir); err != nil {
+				log.Fatalf("failed to get changed targets: %v", err)
+			}
+		}
+		if d.Output != "text" && d.Output != "json" {
+			log.Fatalf("invalid --output: %q (expected: text|json)", d.Output)
+		}
+		timeout, err := common.ResolveDuration(d.Timeout, "timeout", "FLOW_TIMEOUT")
+		if err != nil {
+			log.Fatalf("invalid --timeout: %v", err)
+		}
+		targetTimeout, err := common.ResolveDuration(d.TargetTimeout, "target_timeout", "FLOW_TARGET_TIMEOUT")
 		if err != nil {
-			log.Fatalf("failed to form absolute path to function targets %v", err)
+			log.Fatalf("invalid --target-timeout: %v", err)
 		}
+		report := &runner.Report{KeepGoing: d.KeepGoing, Output: d.Output, Timeout: timeout, TargetTimeout: targetTimeout, DryRun: dryRun}
+		opts := report.Options(common.ResolveJobs(d.Jobs))
+		defer report.Finish()
 
 		if d.CustomCommand != "" {
 			if !strings.HasPrefix(d.CustomCommand, "go ") {
@@ -135,146 +190,217 @@ var BuildCmd = &cobra.Command{
 					os.Exit(1)
 				}
 			}
-			if err := common.RunCustomCommand(targetAbsPaths, d.CustomCommand); err != nil {
-				log.Fatalf("Custom command failed: %v", err)
-			}
+			results, err := common.RunCustomCommand(targets, d.CustomCommand, opts)
+			report.Collect(results, err, "Custom command failed:")
 		}
 
-		imageTag := common.ResolveImageTag(d.ImageTag)
-		imageRepository := common.ResolveImageRepository(d.ImageRepository)
-		imageBuildMethod := common.ResolveImageBuildMethod(d.ImageBuildMethod)
-		cloudProvider := common.ResolveCloudProvider(d.CloudProvider)
-		gcpRegion := common.ResolveGCPRegion(d.GCPRegion)
-		gcpProjectId := common.ResolveGCPProjectId(d.GCPProjectId)
-		awsRegion := common.ResolveAWSRegion(d.AWSRegion)
-		awsAccountId := common.ResolveAWSAccountId(d.AWSAccountId)
-		azureRegistry := common.ResolveAzureRegistry(d.AZURERegistry)
-
-		switch {
-		case imageBuildMethod == "local":
-			fmt.Println("Building local Docker images...")
-			for _, dir := range targetAbsPaths {
-				name := filepath.Base(dir)
-				tag := fmt.Sprintf("local/%s:%s", name, imageTag)
-				args := []string{"build", "--build-arg", "SERVICE=" + name, "-t", tag, dir}
-
-				cmd := exec.Command("docker", args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					log.Fatalf("docker build failed for %s: %v", name, err)
-				}
+		settings := common.ResolveImageSettings(common.ImageSettings{
+			Tag:           d.ImageTag,
+			Repository:    d.ImageRepository,
+			BuildMethod:   d.ImageBuildMethod,
+			CloudProvider: d.CloudProvider,
+			GCPRegion:     d.GCPRegion,
+			GCPProjectId:  d.GCPProjectId,
+			AWSRegion:     d.AWSRegion,
+			AWSAccountId:  d.AWSAccountId,
+			AZURERegistry: d.AZURERegistry,
+			NameInPath:    d.ImageNameInPath,
+		})
+		// An image already pushed from the same inputs under the same
+		// reference is not built again. Local images aren't cached: the
+		// daemon may have lost them, and a remote hit says nothing about
+		// this machine's daemon.
+		var c *cache.Cache
+		var resolver *get.GoDepResolver
+		if !d.NoCache && !dryRun {
+			if c, err = cache.Open(projectRoot, "", d.CacheRemote); err != nil {
+				log.Fatalf("failed to open build cache: %v", err)
 			}
+			if resolver, err = get.NewGoDepResolver(projectRoot); err != nil {
+				log.Fatalf("failed to scan go modules: %v", err)
+			}
+		}
 
-		case cloudProvider == "gcp" && imageBuildMethod == "docker":
-			if gcpRegion == "" || gcpProjectId == "" {
-				log.Fatal("--gcp-region and --gcp-project are required for GCP docker builds")
+		tasks := make([]runner.Task, 0, len(targets))
+		pushedBy := make(map[string]string)
+		for _, t := range targets {
+			// A target manifest may pick its own build method.
+			method := settings.MethodFor(t)
+			if method == "" {
+				continue // noting to built
 			}
-			fmt.Println("Building & pushing GCP Docker images...")
-			for _, dir := range targetAbsPaths {
-				name := filepath.Base(dir)
-				tag := fmt.Sprintf("%s-docker.pkg.dev/%s/%s/%s:%s",
-					gcpRegion, gcpProjectId, imageRepository, name, imageTag,
-				)
-				buildArgs := []string{"build", "--build-arg", "SERVICE=" + name, "-t", tag, dir}
-
-				// build
-				buildCmd := exec.Command("docker", buildArgs...)
-				buildCmd.Stdout = os.Stdout
-				buildCmd.Stderr = os.Stderr
-				if err := buildCmd.Run(); err != nil {
-					log.Fatalf("docker build failed for %s: %v", name, err)
-				}
+			operation := "image:" + method
 
-				// push
-				pushCmd := exec.Command("docker", "push", tag)
-				pushCmd.Stdout = os.Stdout
-				pushCmd.Stderr = os.Stderr
-				if err := pushCmd.Run(); err != nil {
-					log.Fatalf("docker push failed for %s: %v", name, err)
+			var key string
+			ref := settings.ImageReference(t, method)
+			if other, ok := pushedBy[ref]; ok && ref != "" && method != "local" {
+				fmt.Fprintf(os.Stderr, "→ %s and %s both push %s, the last one wins. Set --image-name-in-path to give each target its own repository\n", other, t.ID(), ref)
+			}
+			pushedBy[ref] = t.ID()
+			if c != nil && method != "local" && ref != "" {
+				if key, err = imageKey(resolver, t, method, settings); err != nil {
+					log.Fatalf("failed to hash inputs of %s: %v", t.ID(), err)
 				}
 			}
+			tasks = append(tasks, runner.Task{
+				Target:    t.ID(),
+				Operation: operation,
+				Timeout:   t.Timeout(),
+				Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+					if key != "" {
+						e, err := c.Lookup(key)
+						if err != nil {
+							return err
+						}
+						if e != nil {
+							if registryHasImage(ctx, method, ref) {
+								fmt.Fprintf(stdout, "→ Cached %s image %s\n", method, ref)
+								return runner.ErrCached
+							}
+							fmt.Fprintf(stdout, "→ Cached image %s is missing from the registry, rebuilding\n", ref)
+						}
+					}
+					runner.PlanFrom(ctx).Add(ctx, runner.Step{Image: ref})
+					if err := buildImage(ctx, t, method, settings, stdout, stderr); err != nil {
+						return err
+					}
+					if key != "" {
+						return c.Store(cache.Entry{Key: key, Target: t.ID(), Operation: operation}, t.Dir)
+					}
+					return nil
+				},
+			})
+		}
+		results, err := runner.Run(tasks, opts)
+		report.Collect(results, err, "image build failed:")
+	},
+}
 
-		case cloudProvider == "aws" && imageBuildMethod == "docker":
-			if awsAccountId == "" || awsRegion == "" {
-				log.Fatal("--aws-account and --aws-region is required for AWS docker builds")
-			}
+// dockerBuildArgs returns the --build-arg flags of t: SERVICE=<image name>,
+// then the manifest build args in key order, which may override SERVICE.
+func dockerBuildArgs(t common.Target) []string {
+	args := map[string]string{"SERVICE": t.ImageName()}
+	if t.Manifest != nil {
+		for k, v := range t.Manifest.Build.Args {
+			args[k] = v
+		}
+	}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var flags []string
+	for _, k := range keys {
+		flags = append(flags, "--build-arg", k+"="+args[k])
+	}
+	return flags
+}
 
-			fmt.Println("Building & pushing AWS ECR images...")
-			for _, dir := range targetAbsPaths {
-				name := filepath.Base(dir)
-				tag := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:%s",
-					awsAccountId, awsRegion, imageRepository, imageTag,
-				)
-				buildArgs := []string{"build", "--build-arg", "SERVICE=" + name, "-t", tag, dir}
-
-				buildCmd := exec.Command("docker", buildArgs...)
-				buildCmd.Stdout = os.Stdout
-				buildCmd.Stderr = os.Stderr
-				if err := buildCmd.Run(); err != nil {
-					log.Fatalf("docker build failed for %s: %v", name, err)
-				}
+// imageKey returns the cache key of building the image of t with method:
+// the target's inputs, the image reference, build args and build tool.
+func imageKey(resolver *get.GoDepResolver, t common.Target, method string, s common.ImageSettings) (string, error) {
+	in, err := get.TargetInputs(resolver, t)
+	if err != nil {
+		return "", err
+	}
+	in.Env = append(in.Env,
+		"PROVIDER="+s.CloudProvider,
+		"REFERENCE="+s.ImageReference(t, method),
+		"BUILD_ARGS="+strings.Join(dockerBuildArgs(t), " "),
+	)
+	if method == "cloud-build" {
+		in.Env = append(in.Env, fmt.Sprintf("SUBSTITUTIONS=%s,%s,%s,%s", s.GCPRegion, s.GCPProjectId, s.Repository, s.Tag))
+		in.Tools = append(in.Tools, cache.ToolVersion("gcloud", "--version"))
+	} else {
+		in.Tools = append(in.Tools, cache.ToolVersion("docker", "--version"))
+	}
+	return in.Key("image:" + method)
+}
 
-				pushCmd := exec.Command("docker", "push", tag)
-				pushCmd.Stdout = os.Stdout
-				pushCmd.Stderr = os.Stderr
-				if err := pushCmd.Run(); err != nil {
-					log.Fatalf("docker push failed for %s: %v", name, err)
-				}
-			}
+// registryHasImage reports whether ref exists in its registry.
+func registryHasImage(ctx context.Context, method, ref string) bool {
+	if method == "cloud-build" {
+		return runner.Exec(ctx, io.Discard, io.Discard, "", nil, "gcloud", "artifacts", "docker", "images", "describe", ref, "--quiet") == nil
+	}
+	return runner.Exec(ctx, io.Discard, io.Discard, "", nil, "docker", "manifest", "inspect", ref) == nil
+}
 
-		case cloudProvider == "azure" && imageBuildMethod == "docker":
-			if azureRegistry == "" {
-				log.Fatal("--azure-registry is required for Azure docker builds")
-			}
-			fmt.Println("Building & pushing Azure ACR images...")
-			for _, dir := range targetAbsPaths {
-				name := filepath.Base(dir)
-				tag := fmt.Sprintf("%s.azurecr.io/%s:%s", azureRegistry, imageRepository, imageTag)
-				buildArgs := []string{"build", "--build-arg", "SERVICE=" + name, "-t", tag, dir}
-
-				buildCmd := exec.Command("docker", buildArgs...)
-				buildCmd.Stdout = os.Stdout
-				buildCmd.Stderr = os.Stderr
-				if err := buildCmd.Run(); err != nil {
-					log.Fatalf("docker build failed for %s: %v", name, err)
-				}
+// buildImage builds (and, for registries, pushes) the image of t with method.
+func buildImage(ctx context.Context, t common.Target, method string, s common.ImageSettings, stdout, stderr io.Writer) error {
+	dir, name := t.Dir, t.ImageName()
+
+	switch {
+	case method == "local":
+		fmt.Fprintf(stdout, "Building local Docker image for %s...\n", name)
+		args := append([]string{"build"}, dockerBuildArgs(t)...)
+		args = append(args, "-t", s.ImageReference(t, method), dir)
+		if err := runner.Exec(ctx, stdout, stderr, "", nil, "docker", args...); err != nil {
+			return fmt.Errorf("docker build failed for %s: %w", name, err)
+		}
+		return nil
 
-				pushCmd := exec.Command("docker", "push", tag)
-				pushCmd.Stdout = os.Stdout
-				pushCmd.Stderr = os.Stderr
-				if err := pushCmd.Run(); err != nil {
-					log.Fatalf("docker push failed for %s: %v", name, err)
-				}
-			}
+	case s.CloudProvider == "gcp" && method == "docker":
+		if s.GCPRegion == "" || s.GCPProjectId == "" {
+			return fmt.Errorf("--gcp-region and --gcp-project are required for GCP docker builds")
+		}
+		fmt.Fprintf(stdout, "Building & pushing GCP Docker image for %s...\n", name)
+		return dockerBuildAndPush(ctx, t, s.ImageReference(t, method), stdout, stderr)
 
-		case cloudProvider == "gcp" && imageBuildMethod == "cloud-build":
-			if gcpRegion == "" || gcpProjectId == "" {
-				log.Fatal("--gcp-region and --gcp-project are required for GCP cloud-build")
-			}
-			fmt.Println("→ Submitting GCP Cloud Build jobs...")
-			for _, dir := range targetAbsPaths {
-				name := filepath.Base(dir)
-				substs := fmt.Sprintf("_SERVICE=%s,_REGION=%s,_PROJECT=%s,_REPOSITORY=%s,_TAG=%s",
-					name, gcpRegion, gcpProjectId, imageRepository, imageTag,
-				)
-				cmd := exec.Command(
-					"gcloud", "builds", "submit", dir,
-					"--config="+filepath.Join(dir, "cloudbuild.yaml"),
-					"--substitutions="+substs,
-				)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					log.Fatalf("gcloud build submit failed for %s: %v", name, err)
-				}
-			}
+	case s.CloudProvider == "aws" && method == "docker":
+		if s.AWSAccountId == "" || s.AWSRegion == "" {
+			return fmt.Errorf("--aws-account and --aws-region is required for AWS docker builds")
+		}
+		fmt.Fprintf(stdout, "Building & pushing AWS ECR image for %s...\n", name)
+		return dockerBuildAndPush(ctx, t, s.ImageReference(t, method), stdout, stderr)
 
-		case imageBuildMethod == "":
-			// noting to built
+	case s.CloudProvider == "azure" && method == "docker":
+		if s.AZURERegistry == "" {
+			return fmt.Errorf("--azure-registry is required for Azure docker builds")
+		}
+		fmt.Fprintf(stdout, "Building & pushing Azure ACR image for %s...\n", name)
+		return dockerBuildAndPush(ctx, t, s.ImageReference(t, method), stdout, stderr)
 
-		default:
-			log.Fatalf("unsupported combination: provider=%q method=%q", cloudProvider, imageBuildMethod)
+	case s.CloudProvider == "gcp" && method == "cloud-build":
+		if s.GCPRegion == "" || s.GCPProjectId == "" {
+			return fmt.Errorf("--gcp-region and --gcp-project are required for GCP cloud-build")
 		}
-	},
+		fmt.Fprintf(stdout, "→ Submitting GCP Cloud Build job for %s...\n", name)
+		config := "cloudbuild.yaml"
+		if t.Manifest != nil && t.Manifest.Build.CloudBuildConfig != "" {
+			config = t.Manifest.Build.CloudBuildConfig
+		}
+		substs := fmt.Sprintf("_SERVICE=%s,_REGION=%s,_PROJECT=%s,_REPOSITORY=%s,_TAG=%s",
+			name, s.GCPRegion, s.GCPProjectId, s.Repository, s.Tag,
+		)
+		err := runner.Exec(ctx, stdout, stderr, "", nil,
+			"gcloud", "builds", "submit", dir,
+			"--config="+filepath.Join(dir, config),
+			"--substitutions="+substs,
+		)
+		if err != nil {
+			return fmt.Errorf("gcloud build submit failed for %s: %w", name, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported combination: provider=%q method=%q", s.CloudProvider, method)
+}
+
+func dockerBuildAndPush(ctx context.Context, t common.Target, tag string, stdout, stderr io.Writer) error {
+	name := t.ImageName()
+	buildArgs := append([]string{"build"}, dockerBuildArgs(t)...)
+	buildArgs = append(buildArgs, "-t", tag, t.Dir)
+
+	// build
+	if err := runner.Exec(ctx, stdout, stderr, "", nil, "docker", buildArgs...); err != nil {
+		return fmt.Errorf("docker build failed for %s: %w", name, err)
+	}
+
+	// push
+	if err := runner.Exec(ctx, stdout, stderr, "", nil, "docker", "push", tag); err != nil {
+		return fmt.Errorf("docker push failed for %s: %w", name, err)
+	}
+	return nil
 }
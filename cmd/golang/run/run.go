@@ -4,38 +4,99 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/selimacerbas/flow/internal/cache"
 	"github.com/selimacerbas/flow/internal/common"
 	"github.com/selimacerbas/flow/internal/golang"
+	"github.com/selimacerbas/flow/internal/lint"
+	"github.com/selimacerbas/flow/internal/runner"
 	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
 )
 
 type RunCmdOptions struct {
-	Scope         string
-	Targets       []string
-	CustomCommand string
-	GoOS          string
-	GoArch        string
-	GoPrivate     string
-	AuthMethod    string
-	GitOwner      string
-	GitToken      string
+	Scope          string
+	Targets        []string
+	Selector       string
+	ChangedBetween []string
+	Jobs           int
+	KeepGoing      bool
+	Timeout        time.Duration
+	TargetTimeout  time.Duration
+	Output         string
+	NoCache        bool
+	CacheRemote    string
+	OutDir         string
+	NameTemplate   string
+	TrimPath       bool
+	CGO            string
+	LDFlags        string
+	BuildVersion   string
+	Artifacts      string
+	Race           bool
+	TestRun        string
+	Short          bool
+	JUnit          string
+	CoverProfile   string
+	CoverageMin    float64
+	Linter         string
+	LintFormat     string
+	LintReport     string
+	NewOnly        bool
+	CustomCommand  string
+	GoOS           string
+	GoArch         string
+	Platforms      []string
+	GoPrivate      string
+	AuthMethod     string
+	GitOwner       string
+	GitToken       string
 }
 
 var defaults = &RunCmdOptions{
-	Scope:         "",
-	Targets:       []string{},
-	CustomCommand: "",
-	GoOS:          "",
-	GoArch:        "",
-	GoPrivate:     "",
-	AuthMethod:    "",
-	GitOwner:      "",
-	GitToken:      "",
+	Scope:          "",
+	Targets:        []string{},
+	Selector:       "",
+	ChangedBetween: []string{},
+	Jobs:           0,
+	KeepGoing:      false,
+	Timeout:        0,
+	TargetTimeout:  0,
+	Output:         "text",
+	NoCache:        false,
+	CacheRemote:    "",
+	OutDir:         "",
+	NameTemplate:   "",
+	TrimPath:       false,
+	CGO:            "",
+	LDFlags:        "",
+	BuildVersion:   "",
+	Artifacts:      "",
+	Race:           false,
+	TestRun:        "",
+	Short:          false,
+	JUnit:          "",
+	CoverProfile:   "",
+	CoverageMin:    0,
+	Linter:         "",
+	LintFormat:     lint.FormatText,
+	LintReport:     "",
+	NewOnly:        false,
+	CustomCommand:  "",
+	GoOS:           "",
+	GoArch:         "",
+	Platforms:      []string{},
+	GoPrivate:      "",
+	AuthMethod:     "",
+	GitOwner:       "",
+	GitToken:       "",
 }
 
 type RunSubCmds struct {
@@ -43,6 +104,8 @@ type RunSubCmds struct {
 	Mod    string
 	Vendor string
 	Build  string
+	Test   string
+	Lint   string
 	Custom string
 }
 
@@ -51,6 +114,8 @@ var subs = &RunSubCmds{
 	Mod:    "mod",
 	Vendor: "vendor",
 	Build:  "build",
+	Test:   "test",
+	Lint:   "lint",
 	Custom: "custom",
 }
 
@@ -59,17 +124,44 @@ func init() {
 	f := RunCmd.Flags()
 
 	// I would want to keep the flags users can pass to any operation
-    f.StringVar(&d.Scope, "scope", d.Scope, "Kind of target (function|service)")
-    f.StringSliceVarP(&d.Targets, "targets", "t", d.Targets, "Target names. Repeat or comma-separate.")
-    f.StringVarP(&d.CustomCommand, "command", "c", d.CustomCommand, "Custom go command(s) to run in each target (e.g., 'go clean ./... && go build'). Must start with 'go '.")
+	f.StringVar(&d.Scope, "scope", d.Scope, "Kind(s) of target: a kind name from config, comma-separated names, or all")
+	f.StringSliceVarP(&d.Targets, "targets", "t", d.Targets, "Target names. Repeat or comma-separate.")
+	f.StringVarP(&d.Selector, "selector", "l", d.Selector, "Label selector, e.g. 'team=payments,tier!=experimental' or 'tier in (critical,high)'")
+	f.IntVarP(&d.Jobs, "jobs", "j", d.Jobs, "Number of targets to process at once. Reads from config 'jobs'. Default: CPU count")
+	f.BoolVar(&d.KeepGoing, "keep-going", d.KeepGoing, "Run every target even if some fail, then print a summary and exit non-zero on failure")
+	f.DurationVar(&d.Timeout, "timeout", d.Timeout, "Stop everything still running after this long, e.g. 30m. Reads from config 'timeout'")
+	f.DurationVar(&d.TargetTimeout, "target-timeout", d.TargetTimeout, "Stop each target's operation after this long, e.g. 10m. Reads from config 'target_timeout'; a target manifest 'timeout' wins")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Summary format (text|json). json implies a summary and moves command output to stderr")
+	f.BoolVar(&d.NoCache, "no-cache", d.NoCache, "Always build, ignoring and not filling the build cache (.flow/cache, config 'cache.dir')")
+	f.StringVar(&d.CacheRemote, "cache-remote", d.CacheRemote, "Shared build cache: http(s) URL or dir. Reads from config 'cache.remote' or FLOW_CACHE_REMOTE")
+	f.StringSliceVar(&d.ChangedBetween, "changed-between", d.ChangedBetween, "Only targets changed between two refs: A..B, A,B or the flag repeated")
+	f.StringVar(&d.OutDir, "out-dir", d.OutDir, "build: write binaries to this dir, with version info injected and an artifacts.json manifest. Reads from config 'go.out_dir'")
+	f.StringVar(&d.NameTemplate, "name", d.NameTemplate, "build: binary name template, e.g. '{{.Name}}_{{.GOOS}}_{{.GOARCH}}{{.Ext}}'. Reads from config 'go.name_template'. Default: "+golang.DefaultOutputName)
+	f.BoolVar(&d.TrimPath, "trimpath", d.TrimPath, "build: remove file system paths from binaries. Reads from config 'go.trimpath'")
+	f.StringVar(&d.CGO, "cgo", d.CGO, "build: CGO_ENABLED for builds (0|1). Reads from config 'go.cgo_enabled'; inherited when unset")
+	f.StringVar(&d.LDFlags, "ldflags", d.LDFlags, "build: extra -ldflags, e.g. '-s -w'. Reads from config 'go.ldflags'")
+	f.StringVar(&d.BuildVersion, "build-version", d.BuildVersion, "build: version injected with --out-dir. Reads from config 'go.build_version'. Default: git describe")
+	f.StringVar(&d.Artifacts, "artifacts", d.Artifacts, "build: write the artifact manifest to this file. Default: <out-dir>/artifacts.json")
+	f.BoolVar(&d.Race, "race", d.Race, "test: enable the race detector")
+	f.StringVar(&d.TestRun, "run", d.TestRun, "test: only run tests matching this regexp, as go test -run")
+	f.BoolVar(&d.Short, "short", d.Short, "test: tell long-running tests to shorten their run time")
+	f.StringVar(&d.JUnit, "junit", d.JUnit, "test: write a JUnit XML report of every package to this file")
+	f.StringVar(&d.CoverProfile, "coverprofile", d.CoverProfile, "test: write the coverage profiles of every target, merged, to this file")
+	f.Float64Var(&d.CoverageMin, "coverage-min", d.CoverageMin, "test: fail targets whose coverage is below this percent; a target manifest 'test.coverage_min' wins")
+	f.StringVar(&d.Linter, "linter", d.Linter, "lint: external linter command run in each target after go vet, e.g. 'staticcheck ./...'. Reads from config 'lint.command'")
+	f.StringVar(&d.LintFormat, "lint-format", d.LintFormat, "lint: findings format (text|json|sarif|github)")
+	f.StringVar(&d.LintReport, "lint-report", d.LintReport, "lint: write findings to this file instead of stdout")
+	f.BoolVar(&d.NewOnly, "new-only", d.NewOnly, "lint: only report findings on lines changed between the --changed-between refs")
+	f.StringVarP(&d.CustomCommand, "command", "c", d.CustomCommand, "Custom go command(s) to run in each target (e.g., 'go clean ./... && go build'). Must start with 'go '.")
 
-    f.StringVar(&d.GoOS, "os", d.GoOS, "GOOS for builds. Overrides config 'go.os'.")
-    f.StringVar(&d.GoArch, "arch", d.GoArch, "GOARCH for builds. Overrides config 'go.arch'.")
-    f.StringVar(&d.GoPrivate, "private", d.GoPrivate, "Comma-separated private module hosts for GOPRIVATE (e.g., github.com,gitlab.com)")
+	f.StringVar(&d.GoOS, "os", d.GoOS, "GOOS for builds. Overrides config 'go.os'.")
+	f.StringVar(&d.GoArch, "arch", d.GoArch, "GOARCH for builds. Overrides config 'go.arch'.")
+	f.StringSliceVar(&d.Platforms, "platforms", d.Platforms, "Build every os/arch pair, e.g. linux/amd64,linux/arm64,darwin/arm64. Reads from config 'go.platforms'; a target manifest 'build.platforms' wins over config")
+	f.StringVar(&d.GoPrivate, "private", d.GoPrivate, "Comma-separated private module hosts for GOPRIVATE (e.g., github.com,gitlab.com)")
 
-    f.StringVar(&d.AuthMethod, "auth-method", d.AuthMethod, "Git auth for private modules (ssh|https)")
-    f.StringVar(&d.GitOwner, "git-owner", d.GitOwner, "Owner/org used with https auth")
-    f.StringVar(&d.GitToken, "git-token", d.GitToken, "Token/app password used with https auth")
+	f.StringVar(&d.AuthMethod, "auth-method", d.AuthMethod, "Git auth for private modules (ssh|https)")
+	f.StringVar(&d.GitOwner, "git-owner", d.GitOwner, "Owner/org used with https auth")
+	f.StringVar(&d.GitToken, "git-token", d.GitToken, "Token/app password used with https auth")
 
 	// bind to viper (same as before)
 	_ = viper.BindPFlag("go.os", f.Lookup("os"))
@@ -82,12 +174,14 @@ func init() {
 
 var RunCmd = &cobra.Command{
 	Use:   "run [operation]",
-	Short: "Manage Go functions (clean, mod, vendor, build, custom)",
+	Short: "Manage Go functions (clean, mod, vendor, build, test, lint, custom)",
 	ValidArgs: []string{
 		subs.Clean,
 		subs.Mod,
 		subs.Vendor,
 		subs.Build,
+		subs.Test,
+		subs.Lint,
 		subs.Custom,
 	},
 	Args: cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
@@ -107,40 +201,62 @@ var RunCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("failed to get service-subdir flag: %v", err)
 		}
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
+		}
 
 		projectRoot, err := utils.DetectProjectRoot()
 		if err != nil {
 			log.Fatalf("failed to detect project root %v", err)
 		}
 
-		srcDir = common.ResolveSrcDir(srcDir)
 		scope := common.ResolveScope(d.Scope)
-		var subDir string
-
-		switch scope {
-		case "function":
-			subDir = common.ResolveFunctionsDir(subFuncDir)
-
-		case "service":
-			subDir = common.ResolveServicesDir(subSvcDir)
+		kinds, err := common.ResolveScopeKinds(scope, srcDir, subFuncDir, subSvcDir)
+		if err != nil {
+			log.Fatalf("failed to resolve kinds for scope %q: %v", scope, err)
 		}
-
-		absPath := utils.FormAbsolutePathToDir(projectRoot, srcDir, subDir)
-		targetAbsPaths, err := utils.FormAbsolutePathToTargetDirs(absPath, d.Targets)
+		targets, err := common.ResolveKindTargets(projectRoot, kinds, d.Targets)
 		if err != nil {
 			log.Fatalf("failed to form absolute path to %s targets %v", scope, err)
 		}
+		if targets, err = common.FilterTargets(targets, d.Selector); err != nil {
+			log.Fatalf("failed to apply --selector: %v", err)
+		}
+		if len(d.ChangedBetween) > 0 {
+			ref1, ref2, err := get.ParseRefRange(d.ChangedBetween)
+			if err != nil {
+				log.Fatalf("invalid --changed-between: %v", err)
+			}
+			if targets, err = get.FilterChanged(targets, ref1, ref2, scope, srcDir, subFuncDir, subSvcDir); err != nil {
+				log.Fatalf("failed to get changed targets: %v", err)
+			}
+		}
+		if d.Output != "text" && d.Output != "json" {
+			log.Fatalf("invalid --output: %q (expected: text|json)", d.Output)
+		}
+		timeout, err := common.ResolveDuration(d.Timeout, "timeout", "FLOW_TIMEOUT")
+		if err != nil {
+			log.Fatalf("invalid --timeout: %v", err)
+		}
+		targetTimeout, err := common.ResolveDuration(d.TargetTimeout, "target_timeout", "FLOW_TARGET_TIMEOUT")
+		if err != nil {
+			log.Fatalf("invalid --target-timeout: %v", err)
+		}
+		report := &runner.Report{KeepGoing: d.KeepGoing, Output: d.Output, Timeout: timeout, TargetTimeout: targetTimeout, DryRun: dryRun}
+		opts := report.Options(common.ResolveJobs(d.Jobs))
+		defer report.Finish()
 
 		// Configure GOPRIVATE + auth (safe even if no private hosts)
 		privateHosts := golang.ResolveGoPrivate(d.GoPrivate)
-		if err := golang.SetEnvGOPrivate(privateHosts); err != nil {
+		if err := golang.SetEnvGOPrivate(opts.Context, privateHosts); err != nil {
 			log.Fatalf("failed to set GOPRIVATE: %v", err)
 		}
 
 		authMethod := common.ResolveAuthMethod(d.AuthMethod)
 		switch authMethod {
 		case "ssh":
-			if err := common.SetGitAuthSSH(privateHosts); err != nil {
+			if err := common.SetGitAuthSSH(opts.Context, privateHosts); err != nil {
 				log.Fatalf("failed to set git auth SSH %v", err)
 			}
 		case "https":
@@ -149,11 +265,11 @@ var RunCmd = &cobra.Command{
 			if owner == "" || token == "" {
 				log.Fatalf("--git-owner and --git-token is required when configuring private HTTPS hosts. consider passing via flag, config or ENV")
 			}
-			if err := common.SetGitAuthHTTPS(privateHosts, owner, token); err != nil {
+			if err := common.SetGitAuthHTTPS(opts.Context, privateHosts, owner, token); err != nil {
 				log.Fatalf("failed to git auth HTTPS %v", err)
 			}
 		case "":
-			fmt.Printf("no --auth-method has passed or configured. Meaning there is no private hosts to be authenticated.")
+			fmt.Fprintln(os.Stderr, "no --auth-method has passed or configured. Meaning there is no private hosts to be authenticated.")
 		default:
 			log.Fatalf("invalid auth-method: %q (expected 'ssh' or 'https')", authMethod)
 		}
@@ -165,33 +281,183 @@ var RunCmd = &cobra.Command{
 					os.Exit(1)
 				}
 			}
-			if err := common.RunCustomCommand(targetAbsPaths, d.CustomCommand); err != nil {
-				log.Fatalf("Custom command failed: %v", err)
-			}
+			results, err := common.RunCustomCommand(targets, d.CustomCommand, opts)
+			report.Collect(results, err, "Custom command failed:")
 		}
 
 		switch operation {
 		case subs.Clean:
-			if err := golang.RunGoClean(targetAbsPaths); err != nil {
-				log.Fatalf("failed to run go clean %v", err)
-			}
+			results, err := golang.RunGoClean(targets, opts)
+			report.Collect(results, err, "failed to run go clean")
 
 		case subs.Mod:
-			if err := golang.RunGoMod(targetAbsPaths); err != nil {
-				log.Fatalf("failed to run go mod %v", err)
-			}
+			results, err := golang.RunGoMod(targets, opts)
+			report.Collect(results, err, "failed to run go mod")
 
 		case subs.Vendor:
-			if err := golang.RunGoVendor(targetAbsPaths); err != nil {
-				log.Fatalf("failed to run go vendor %v", err)
-			}
+			results, err := golang.RunGoVendor(targets, opts)
+			report.Collect(results, err, "failed to run go vendor")
 
 		case subs.Build:
-			goOS := golang.ResolveENVGoOS(d.GoOS)
-			goArch := golang.ResolveENVGoArch(d.GoArch)
-			if err := golang.RunGoBuild(targetAbsPaths, goOS, goArch); err != nil {
-				log.Fatalf("failed to run go build %v", err)
+			// --os/--arch win over a target manifest, which wins over config and env.
+			// Unchanged inputs reuse the binary from the cache.
+			var c *cache.Cache
+			var resolver *get.GoDepResolver
+			if !d.NoCache && !dryRun {
+				if c, err = cache.Open(projectRoot, "", d.CacheRemote); err != nil {
+					log.Fatalf("failed to open build cache: %v", err)
+				}
+				if resolver, err = get.NewGoDepResolver(projectRoot); err != nil {
+					log.Fatalf("failed to scan go modules: %v", err)
+				}
+			}
+			outDir := utils.ResolveStringValue(d.OutDir, "go.out_dir", "FLOW_GO_OUT_DIR")
+			if outDir != "" && !filepath.IsAbs(outDir) {
+				outDir = filepath.Join(projectRoot, outDir)
+			}
+			nameTemplate := utils.ResolveStringValue(d.NameTemplate, "go.name_template")
+			cgo, err := golang.ResolveCGOEnabled(d.CGO)
+			if err != nil {
+				log.Fatalf("invalid --cgo: %v", err)
+			}
+			// Only artifact builds carry version info: it changes with every
+			// commit, and so would the cache key of every in-place build.
+			var info *golang.BuildInfo
+			if outDir != "" {
+				if info, err = resolveBuildInfo(projectRoot, d.BuildVersion); err != nil {
+					log.Fatalf("failed to resolve build info: %v", err)
+				}
+			}
+
+			// --platforms is exclusive with --os/--arch. Otherwise a manifest's
+			// platforms, then its goos/goarch, win over config.
+			if len(d.Platforms) > 0 && (d.GoOS != "" || d.GoArch != "") {
+				log.Fatalf("--platforms cannot be combined with --os or --arch")
+			}
+			platforms, err := golang.ParsePlatforms(d.Platforms)
+			if err != nil {
+				log.Fatalf("invalid --platforms: %v", err)
+			}
+			configPlatforms, err := golang.ResolvePlatforms(nil)
+			if err != nil {
+				log.Fatalf("invalid config 'go.platforms': %v", err)
+			}
+
+			builds := make([]golang.GoBuild, 0, len(targets))
+			for _, t := range targets {
+				goOS, goArch := d.GoOS, d.GoArch
+				base := golang.GoBuild{
+					Target:     t,
+					TrimPath:   d.TrimPath || viper.GetBool("go.trimpath"),
+					CGOEnabled: cgo,
+					LDFlags:    utils.ResolveStringValue(d.LDFlags, "go.ldflags"),
+					Info:       info,
+				}
+				ps := platforms
+				pinned := len(ps) > 0 || goOS != "" || goArch != ""
+				if m := t.Manifest; m != nil {
+					if !pinned && len(m.Build.Platforms) > 0 {
+						if ps, err = golang.ParsePlatforms(m.Build.Platforms); err != nil {
+							log.Fatalf("invalid platforms of %s: %v", t.ID(), err)
+						}
+					}
+					pinned = pinned || len(ps) > 0 || m.Build.GOOS != "" || m.Build.GOARCH != ""
+					if goOS == "" {
+						goOS = m.Build.GOOS
+					}
+					if goArch == "" {
+						goArch = m.Build.GOARCH
+					}
+					base.Package = m.Entrypoint
+				}
+				if !pinned {
+					ps = configPlatforms
+				}
+				if len(ps) == 0 {
+					ps = []golang.Platform{{GOOS: golang.ResolveENVGoOS(goOS), GOARCH: golang.ResolveENVGoArch(goArch)}}
+				}
+
+				if c != nil {
+					if base.Inputs, err = get.TargetInputs(resolver, t); err != nil {
+						log.Fatalf("failed to collect build inputs: %v", err)
+					}
+				}
+				for _, p := range ps {
+					b := base
+					b.GOOS, b.GOARCH = p.GOOS, p.GOARCH
+					dir, tmpl := outDir, nameTemplate
+					if len(ps) > 1 {
+						// Every platform needs its own binary name.
+						b.Variant = p.String()
+						if tmpl == "" {
+							tmpl = golang.DefaultPlatformOutputName
+						}
+					}
+					if dir != "" || tmpl != "" {
+						if dir == "" {
+							dir = t.Dir
+						}
+						if tmpl == "" {
+							tmpl = golang.DefaultOutputName
+						}
+						version := ""
+						if info != nil {
+							version = info.Version
+						}
+						if b.Output, err = golang.OutputPath(tmpl, dir, b, version); err != nil {
+							log.Fatalf("invalid --name: %v", err)
+						}
+					}
+					builds = append(builds, b)
+				}
+			}
+			results, artifacts, err := golang.RunGoBuild(builds, c, opts)
+			manifest := d.Artifacts
+			if manifest == "" && outDir != "" {
+				manifest = filepath.Join(outDir, golang.ArtifactManifestFile)
+			}
+			if manifest != "" {
+				writeArtifactManifest(opts, manifest, info, artifacts)
+			}
+			report.Collect(results, err, "failed to run go build")
+
+		case subs.Test:
+			if d.CoverageMin < 0 || d.CoverageMin > 100 {
+				log.Fatalf("invalid --coverage-min: %v (expected 0-100)", d.CoverageMin)
+			}
+			results, tr, err := golang.RunGoTest(targets, golang.GoTestOptions{
+				Race:        d.Race,
+				Run:         d.TestRun,
+				Short:       d.Short,
+				CoverageMin: d.CoverageMin,
+			}, opts)
+			if tr != nil {
+				writeTestReport(opts, tr, d.JUnit, d.CoverProfile)
 			}
+			report.Collect(results, err, "failed to run go test")
+
+		case subs.Lint:
+			if !slices.Contains(lint.Formats, d.LintFormat) {
+				log.Fatalf("invalid --lint-format: %q (expected: %s)", d.LintFormat, strings.Join(lint.Formats, "|"))
+			}
+			lo := golang.GoLintOptions{
+				Root:   projectRoot,
+				Linter: utils.ResolveStringValue(d.Linter, "lint.command", "FLOW_LINT_COMMAND"),
+			}
+			if d.NewOnly {
+				if len(d.ChangedBetween) == 0 {
+					log.Fatalf("--new-only needs --changed-between to know which lines are new")
+				}
+				ref1, ref2, _ := get.ParseRefRange(d.ChangedBetween) // checked above
+				changed, err := get.GetChangedLines(projectRoot, ref1, ref2)
+				if err != nil {
+					log.Fatalf("failed to get changed lines: %v", err)
+				}
+				lo.Keep = func(f lint.Finding) bool { return changed.Contains(f.File, f.Line) }
+			}
+			results, lr, err := golang.RunGoLint(targets, lo, opts)
+			writeLintReport(opts, lr, d.LintFormat, d.LintReport)
+			report.Collect(results, err, "failed to run go lint")
 		case subs.Custom:
 			if d.CustomCommand != "" {
 				if !strings.HasPrefix(d.CustomCommand, "go ") {
@@ -200,15 +466,115 @@ var RunCmd = &cobra.Command{
 						os.Exit(1)
 					}
 				}
-				if err := common.RunCustomCommand(targetAbsPaths, d.CustomCommand); err != nil {
-					log.Fatalf("Custom command failed: %v", err)
-				}
+				results, err := common.RunCustomCommand(targets, d.CustomCommand, opts)
+				report.Collect(results, err, "Custom command failed:")
 			} else {
 				log.Fatalf("along with custom operations --command or -c flag has to be set %v", err)
 			}
 
 		default:
-			log.Fatalf("invalid operation %q (expected one of: clean, mod, vendor, build, custom)", operation)
+			log.Fatalf("invalid operation %q (expected one of: clean, mod, vendor, build, test, lint, custom)", operation)
 		}
 	},
 }
+
+// writeTestReport prints the per-package summary and writes the JUnit and
+// coverage files. In a dry run the files are only recorded in the plan.
+func writeTestReport(opts runner.Options, tr *golang.TestReport, junit, coverProfile string) {
+	if plan := runner.PlanFrom(opts.Context); plan != nil {
+		var writes []string
+		for _, f := range []string{junit, coverProfile} {
+			if f != "" {
+				writes = append(writes, f)
+			}
+		}
+		if len(writes) > 0 {
+			plan.Add(opts.Context, runner.Step{Operation: "test-report", Writes: writes})
+		}
+		return
+	}
+
+	out := opts.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintln(out)
+	if err := tr.WriteSummary(out); err != nil {
+		log.Fatalf("failed to write test summary: %v", err)
+	}
+	if junit != "" {
+		if err := tr.WriteJUnit(junit); err != nil {
+			log.Fatalf("failed to write --junit: %v", err)
+		}
+	}
+	if coverProfile != "" {
+		if err := tr.WriteCoverProfile(coverProfile); err != nil {
+			log.Fatalf("failed to write --coverprofile: %v", err)
+		}
+	}
+}
+
+// writeLintReport writes the findings to file, or to stdout when file is
+// empty. In a dry run a file is only recorded in the plan.
+func writeLintReport(opts runner.Options, lr lint.Report, format, file string) {
+	if plan := runner.PlanFrom(opts.Context); plan != nil {
+		if file != "" {
+			plan.Add(opts.Context, runner.Step{Operation: "lint-report", Writes: []string{file}})
+		}
+		return
+	}
+
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			log.Fatalf("failed to create --lint-report: %v", err)
+		}
+		defer f.Close()
+		if err := lint.Write(f, lr, format); err != nil {
+			log.Fatalf("failed to write --lint-report: %v", err)
+		}
+		return
+	}
+
+	out := opts.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	if err := lint.Write(out, lr, format); err != nil {
+		log.Fatalf("failed to write lint findings: %v", err)
+	}
+}
+
+// resolveBuildInfo is the version, commit and build date injected into
+// artifact builds.
+func resolveBuildInfo(projectRoot, versionFlag string) (*golang.BuildInfo, error) {
+	info := &golang.BuildInfo{Version: golang.ResolveBuildVersion(versionFlag), Commit: "unknown"}
+	if sha, err := get.GetCommitSHA(projectRoot, "HEAD"); err == nil {
+		info.Commit = sha
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+		if v, err := get.Describe(projectRoot); err == nil && v != "" {
+			info.Version = v
+		}
+	}
+	date, err := golang.ResolveBuildDate()
+	if err != nil {
+		return nil, err
+	}
+	info.Date = date.Format(time.RFC3339)
+	golang.ResolveLDFlagVars(info)
+	return info, nil
+}
+
+// writeArtifactManifest writes the artifacts built so far, even when some
+// builds failed. In a dry run the file is only recorded in the plan.
+func writeArtifactManifest(opts runner.Options, path string, info *golang.BuildInfo, artifacts []golang.Artifact) {
+	if plan := runner.PlanFrom(opts.Context); plan != nil {
+		plan.Add(opts.Context, runner.Step{Operation: "artifacts", Writes: []string{path}})
+		return
+	}
+	if err := golang.WriteArtifactManifest(path, info, artifacts); err != nil {
+		log.Fatalf("failed to write artifact manifest: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/pkg/list"
+)
+
+type ListCmdOptions struct {
+	Kind     string
+	Selector string
+	Output   string
+}
+
+var defaults = &ListCmdOptions{
+	Kind:     common.ScopeAll,
+	Selector: "",
+	Output:   "text",
+}
+
+type ListCmdOutput struct {
+	Targets []list.TargetInfo `json:"targets" yaml:"targets"`
+}
+
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every target flow discovers, with its language, Go module and image",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		d := defaults
+
+		srcDir, err := cmd.Flags().GetString(common.FlagSrcDir)
+		if err != nil {
+			log.Fatalf("failed to get src-dir flag: %v", err)
+		}
+		funcSub, err := cmd.Flags().GetString(common.FlagFunctionsSubDir)
+		if err != nil {
+			log.Fatalf("failed to get functions-subdir flag: %v", err)
+		}
+		svcSub, err := cmd.Flags().GetString(common.FlagServicesSubDir)
+		if err != nil {
+			log.Fatalf("failed to get services-subdir flag: %v", err)
+		}
+
+		targets, err := list.ListTargets(d.Kind, d.Selector, srcDir, funcSub, svcSub)
+		if err != nil {
+			log.Fatalf("failed to list targets: %v", err)
+		}
+
+		switch d.Output {
+		case "json":
+			if err := json.NewEncoder(os.Stdout).Encode(ListCmdOutput{Targets: targets}); err != nil {
+				log.Fatalf("failed to write json: %v", err)
+			}
+		case "yaml":
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(ListCmdOutput{Targets: targets}); err != nil {
+				log.Fatalf("failed to write yaml: %v", err)
+			}
+		case "text":
+			printTable(targets)
+		default:
+			log.Fatalf("invalid --output: %q (expected: text|json|yaml)", d.Output)
+		}
+	},
+}
+
+func init() {
+	d := defaults
+	f := ListCmd.Flags()
+
+	f.StringVar(&d.Kind, "kind", d.Kind, "Kind(s) to list: a kind name from config, comma-separated names, or all")
+	f.StringVarP(&d.Selector, "selector", "l", d.Selector, "Only list targets whose labels match, e.g. 'team=payments,tier!=experimental'")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Output format (text|json|yaml). Default: text")
+}
+
+func printTable(targets []list.TargetInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tPATH\tLANGUAGE\tGO MODULE\tGO\tDOCKERFILE\tCLOUDBUILD\tIMAGE\tLABELS")
+	for _, t := range targets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.Kind, t.Name, t.Path, dash(t.Language), dash(t.GoModule), dash(t.GoVersion),
+			yesNo(t.Dockerfile), yesNo(t.CloudBuild), dash(t.Image), dash(formatLabels(t.Labels)))
+	}
+	w.Flush()
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -65,6 +65,7 @@ var McpCmd = &cobra.Command{
 		}, embeddedResource)
 
 		mcp.AddTool(server, &mcp.Tool{Name: "changed", Description: "find changed folders"}, tools.ChangedTool(srcDir, funcSub, svcSub))
+		mcp.AddTool(server, &mcp.Tool{Name: "list", Description: "list every target with its metadata"}, tools.ListTool(srcDir, funcSub, svcSub))
 
 		if d.HTTPAddress != "" {
 			handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
@@ -7,10 +7,13 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/selimacerbas/flow/cmd/cache"
 	"github.com/selimacerbas/flow/cmd/commit"
 	"github.com/selimacerbas/flow/cmd/get"
 	"github.com/selimacerbas/flow/cmd/golang"
+	"github.com/selimacerbas/flow/cmd/list"
 	"github.com/selimacerbas/flow/cmd/mcp"
+	"github.com/selimacerbas/flow/cmd/task"
 
 	"github.com/selimacerbas/flow/internal/config"
 )
@@ -24,6 +27,7 @@ type RootCmd struct {
 	SrcDir          string
 	FunctionsSubdir string
 	ServicesSubdir  string
+	DryRun          bool
 }
 
 var defaults = &RootCmd{
@@ -31,6 +35,7 @@ var defaults = &RootCmd{
 	SrcDir:          "",
 	FunctionsSubdir: "",
 	ServicesSubdir:  "",
+	DryRun:          false,
 }
 
 var rootCmd = &cobra.Command{
@@ -49,7 +54,10 @@ func Execute() {
 		golang.GoCmd,
 		get.GetCmd,
 		commit.CommitCmd,
+		cache.CacheCmd,
+		list.ListCmd,
 		mcp.McpCmd,
+		task.TaskCmd,
 	)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -67,8 +75,10 @@ func init() {
 	pf.StringVar(&d.Config, "config", d.Config, "Path to config file. Defaults to 'flow.yaml' in the repo root.")
 
 	pf.StringVar(&d.SrcDir, "src-dir", d.SrcDir, "Root source directory. Reads from config key 'dirs.src'.")
-	pf.StringVar(&d.FunctionsSubdir, "functions-subdir", d.FunctionsSubdir, "Subdirectory under src for cloud functions. Reads from 'dirs.functions_subdir'.")
-	pf.StringVar(&d.ServicesSubdir, "services-subdir", d.ServicesSubdir, "Subdirectory under src for services. Reads from 'dirs.services_subdir'.")
+	pf.StringVar(&d.FunctionsSubdir, "functions-subdir", d.FunctionsSubdir, "Subdirectory under src for cloud functions. Reads from 'dirs.functions_subdir'. Ignored when 'kinds' is configured.")
+	pf.StringVar(&d.ServicesSubdir, "services-subdir", d.ServicesSubdir, "Subdirectory under src for services. Reads from 'dirs.services_subdir'. Ignored when 'kinds' is configured.")
+
+	pf.BoolVar(&d.DryRun, "dry-run", d.DryRun, "Print what would be run, set and written, without doing it. Use -o json for a diffable plan.")
 
 	config.SetDefaults()
 
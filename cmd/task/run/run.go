@@ -0,0 +1,131 @@
+package run
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/task"
+	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
+)
+
+type RunCmdOptions struct {
+	Targets        []string
+	Selector       string
+	ChangedBetween []string
+	Jobs           int
+	KeepGoing      bool
+	Timeout        time.Duration
+	TargetTimeout  time.Duration
+	Output         string
+}
+
+var defaults = &RunCmdOptions{
+	Targets:        []string{},
+	Selector:       "",
+	ChangedBetween: []string{},
+	Jobs:           0,
+	KeepGoing:      false,
+	Timeout:        0,
+	TargetTimeout:  0,
+	Output:         "text",
+}
+
+func init() {
+	d := defaults
+	f := RunCmd.Flags()
+
+	f.StringSliceVarP(&d.Targets, "targets", "t", d.Targets, "Target names. Repeat or comma-separate.")
+	f.StringVarP(&d.Selector, "selector", "l", d.Selector, "Label selector applied on top of each task's own kinds and selector")
+	f.IntVarP(&d.Jobs, "jobs", "j", d.Jobs, "Number of targets to process at once. Reads from config 'jobs'. Default: CPU count")
+	f.BoolVar(&d.KeepGoing, "keep-going", d.KeepGoing, "Run every task whose dependencies succeeded, then print a summary and exit non-zero on failure")
+	f.DurationVar(&d.Timeout, "timeout", d.Timeout, "Stop everything still running after this long, e.g. 30m. Reads from config 'timeout'")
+	f.DurationVar(&d.TargetTimeout, "target-timeout", d.TargetTimeout, "Stop each target's operation after this long, e.g. 10m. Reads from config 'target_timeout'; a target manifest 'timeout' wins")
+	f.StringVarP(&d.Output, "output", "o", d.Output, "Summary format (text|json). json implies a summary and moves command output to stderr")
+	f.StringSliceVar(&d.ChangedBetween, "changed-between", d.ChangedBetween, "Only targets changed between two refs: A..B, A,B or the flag repeated")
+}
+
+var RunCmd = &cobra.Command{
+	Use:   "run [task]",
+	Short: "Run a task and the tasks it depends on across the selected targets",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		d := defaults
+		// viper lower-cases config keys, task names included.
+		name := strings.ToLower(args[0])
+
+		srcDir, err := cmd.Flags().GetString(common.FlagSrcDir)
+		if err != nil {
+			log.Fatalf("failed to get src-dir flag: %v", err)
+		}
+		subFuncDir, err := cmd.Flags().GetString(common.FlagFunctionsSubDir)
+		if err != nil {
+			log.Fatalf("failed to get functions-subdir flag: %v", err)
+		}
+		subSvcDir, err := cmd.Flags().GetString(common.FlagServicesSubDir)
+		if err != nil {
+			log.Fatalf("failed to get service-subdir flag: %v", err)
+		}
+		dryRun, err := cmd.Flags().GetBool(common.FlagDryRun)
+		if err != nil {
+			log.Fatalf("failed to get dry-run flag: %v", err)
+		}
+
+		projectRoot, err := utils.DetectProjectRoot()
+		if err != nil {
+			log.Fatalf("failed to detect project root %v", err)
+		}
+
+		kinds, err := common.ResolveScopeKinds("all", srcDir, subFuncDir, subSvcDir)
+		if err != nil {
+			log.Fatalf("failed to resolve kinds: %v", err)
+		}
+		tasks, err := task.ResolveTasks(kinds)
+		if err != nil {
+			log.Fatalf("invalid tasks config: %v", err)
+		}
+		layers, err := task.Plan(tasks, name)
+		if err != nil {
+			log.Fatalf("failed to plan task %q: %v", name, err)
+		}
+
+		targets, err := common.ResolveKindTargets(projectRoot, kinds, d.Targets)
+		if err != nil {
+			log.Fatalf("failed to form absolute path to targets %v", err)
+		}
+		if targets, err = common.FilterTargets(targets, d.Selector); err != nil {
+			log.Fatalf("failed to apply --selector: %v", err)
+		}
+		if len(d.ChangedBetween) > 0 {
+			ref1, ref2, err := get.ParseRefRange(d.ChangedBetween)
+			if err != nil {
+				log.Fatalf("invalid --changed-between: %v", err)
+			}
+			if targets, err = get.FilterChanged(targets, ref1, ref2, "all", srcDir, subFuncDir, subSvcDir); err != nil {
+				log.Fatalf("failed to get changed targets: %v", err)
+			}
+		}
+		if d.Output != "text" && d.Output != "json" {
+			log.Fatalf("invalid --output: %q (expected: text|json)", d.Output)
+		}
+		timeout, err := common.ResolveDuration(d.Timeout, "timeout", "FLOW_TIMEOUT")
+		if err != nil {
+			log.Fatalf("invalid --timeout: %v", err)
+		}
+		targetTimeout, err := common.ResolveDuration(d.TargetTimeout, "target_timeout", "FLOW_TARGET_TIMEOUT")
+		if err != nil {
+			log.Fatalf("invalid --target-timeout: %v", err)
+		}
+		report := &runner.Report{KeepGoing: d.KeepGoing, Output: d.Output, Timeout: timeout, TargetTimeout: targetTimeout, DryRun: dryRun}
+		opts := report.Options(common.ResolveJobs(d.Jobs))
+		defer report.Finish()
+
+		results, err := task.Run(layers, targets, opts)
+		report.Collect(results, err, "Task "+name+" failed:")
+	},
+}
@@ -0,0 +1,17 @@
+package task
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/selimacerbas/flow/cmd/task/run"
+)
+
+var TaskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Run tasks defined in the 'tasks' section of the config",
+	Long:  "Run named tasks from flow.yaml across targets, dependencies first",
+}
+
+func init() {
+	TaskCmd.AddCommand(run.RunCmd)
+}
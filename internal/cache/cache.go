@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// DefaultDir is the cache location relative to the project root.
+const DefaultDir = ".flow/cache"
+
+const (
+	entryFile  = "entry.json"
+	outputsDir = "outputs"
+)
+
+// Cache stores the outputs of successful operations by input key, one dir
+// per key: <Dir>/<key[:2]>/<key>/{entry.json,outputs/}. With a Remote, local
+// misses are looked up there and new entries are shared through it.
+type Cache struct {
+	Dir    string
+	Remote *Remote
+	// Stderr receives remote cache warnings, os.Stderr when nil. A failing
+	// remote never fails a build, it only costs cache hits.
+	Stderr io.Writer
+}
+
+// Entry describes one cached operation.
+type Entry struct {
+	Key       string            `json:"key"`
+	Target    string            `json:"target"`
+	Operation string            `json:"operation"`
+	Created   time.Time         `json:"created"`
+	Outputs   []string          `json:"outputs,omitempty"`   // relative to the target dir
+	Checksums map[string]string `json:"checksums,omitempty"` // output → sha256
+	Size      int64             `json:"size"`                // bytes of outputs
+}
+
+// ResolveDir returns the cache dir from flagVal, config 'cache.dir' or
+// FLOW_CACHE_DIR, relative to projectRoot unless absolute.
+func ResolveDir(projectRoot, flagVal string) string {
+	dir := utils.ResolveStringValue(flagVal, "cache.dir", "FLOW_CACHE_DIR")
+	if dir == "" {
+		dir = DefaultDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(projectRoot, dir)
+	}
+	return dir
+}
+
+// New returns the cache at dir.
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Open returns the project's cache: at ResolveDir(projectRoot, dirFlag), with
+// the remote from ResolveRemote(remoteFlag), if any.
+func Open(projectRoot, dirFlag, remoteFlag string) (*Cache, error) {
+	c := New(ResolveDir(projectRoot, dirFlag))
+	remote, err := ResolveRemote(remoteFlag)
+	if err != nil {
+		return nil, err
+	}
+	c.Remote = remote
+	return c, nil
+}
+
+func (c *Cache) warnf(format string, args ...any) {
+	w := c.Stderr
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "warning: remote cache: "+format+"\n", args...)
+}
+
+func (c *Cache) entryDir(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Lookup returns the entry stored for key, or nil when there is none. A local
+// miss is fetched from the remote, if any, and kept locally.
+func (c *Cache) Lookup(key string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(c.entryDir(key), entryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		if c.Remote == nil {
+			return nil, nil
+		}
+		e, err := c.fetch(key)
+		if err != nil {
+			c.warnf("%v", err)
+			return nil, nil
+		}
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry %s: %w", key, err)
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("corrupt cache entry %s: %w", key, err)
+	}
+	return &e, nil
+}
+
+// Store copies e.Outputs from dir into the cache and records e under e.Key,
+// with the checksum of every output. The entry is written to a temp dir
+// first, so readers never see it half done. It is then uploaded to the
+// remote, when pushing is on.
+func (c *Cache) Store(e Entry, dir string) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	// Keep the cache out of `git status` without touching the repo's ignores.
+	ignore := filepath.Join(c.Dir, ".gitignore")
+	if _, err := os.Stat(ignore); errors.Is(err, os.ErrNotExist) {
+		_ = os.WriteFile(ignore, []byte("*\n"), 0o644)
+	}
+	tmp, err := os.MkdirTemp(c.Dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	e.Size = 0
+	e.Checksums = make(map[string]string, len(e.Outputs))
+	for _, out := range e.Outputs {
+		cached := filepath.Join(tmp, outputsDir, out)
+		n, err := copyFile(filepath.Join(dir, out), cached)
+		if err != nil {
+			return fmt.Errorf("failed to cache output %s: %w", out, err)
+		}
+		if e.Checksums[out], _, err = hashFile(cached); err != nil {
+			return fmt.Errorf("failed to hash output %s: %w", out, err)
+		}
+		e.Size += n
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now().UTC()
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, entryFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	final := c.entryDir(e.Key)
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	_ = os.RemoveAll(final)
+	if err := os.Rename(tmp, final); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+
+	if c.Remote != nil && c.Remote.Push {
+		if err := c.push(e.Key); err != nil {
+			c.warnf("failed to upload %s: %v", e.Key, err)
+		}
+	}
+	return nil
+}
+
+// Restore copies the outputs of e back into dir.
+func (c *Cache) Restore(e *Entry, dir string) error {
+	for _, out := range e.Outputs {
+		if err := checkLocal(out); err != nil {
+			return fmt.Errorf("failed to restore output: %w", err)
+		}
+		src := filepath.Join(c.entryDir(e.Key), outputsDir, out)
+		if _, err := copyFile(src, filepath.Join(dir, out)); err != nil {
+			return fmt.Errorf("failed to restore output %s: %w", out, err)
+		}
+	}
+	return nil
+}
+
+// Entries returns every entry in the cache, newest first.
+func (c *Cache) Entries() ([]Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(c.Dir, "*", "*", entryFile))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, m := range matches {
+		data, err := os.ReadFile(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache entry: %w", err)
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			continue // half-written by an older flow; Clean removes it
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.After(entries[j].Created) })
+	return entries, nil
+}
+
+// Clean removes entries created before cutoff, or everything when cutoff is
+// zero, and returns how many entries were removed.
+func (c *Cache) Clean(cutoff time.Time) (int, error) {
+	if cutoff.IsZero() {
+		entries, err := c.Entries()
+		if err != nil {
+			return 0, err
+		}
+		if err := os.RemoveAll(c.Dir); err != nil {
+			return 0, fmt.Errorf("failed to remove cache dir: %w", err)
+		}
+		return len(entries), nil
+	}
+
+	entries, err := c.Stale(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if err := os.RemoveAll(c.entryDir(e.Key)); err != nil {
+			return removed, fmt.Errorf("failed to remove cache entry %s: %w", e.Key, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Stale returns the entries created before cutoff.
+func (c *Cache) Stale(cutoff time.Time) ([]Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var stale []Entry
+	for _, e := range entries {
+		if e.Created.Before(cutoff) {
+			stale = append(stale, e)
+		}
+	}
+	return stale, nil
+}
+
+// EntryDir is where the entry of key is stored.
+func (c *Cache) EntryDir(key string) string {
+	return c.entryDir(key)
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	tmp := dst + ".flow-tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, os.Rename(tmp, dst)
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/selimacerbas/flow/internal/runner"
+)
+
+// keyVersion changes whenever the way keys are computed does, so that old
+// entries stop matching.
+const keyVersion = "1"
+
+// Inputs is everything a cached operation depends on. Paths are relative to
+// Root and use forward slashes.
+type Inputs struct {
+	Root    string
+	Trees   []string // dirs hashed recursively
+	Dirs    []string // dirs whose files, but not subdirs, are hashed
+	Files   []string // single files; missing ones are recorded as such
+	Env     []string // KEY=VALUE pairs that change the result
+	Tools   []string // tool versions, see ToolVersion
+	Exclude []string // paths left out of Trees and Dirs, e.g. outputs
+}
+
+// Key returns the hex sha256 of operation and every input. Files are hashed
+// by content and mode; timestamps don't matter.
+func (in Inputs) Key(operation string) (string, error) {
+	excluded := make(map[string]bool, len(in.Exclude))
+	for _, p := range in.Exclude {
+		excluded[path.Clean(p)] = true
+	}
+
+	files := make(map[string]bool)
+	for _, f := range in.Files {
+		files[path.Clean(f)] = true
+	}
+	for _, tree := range in.Trees {
+		if err := in.walk(tree, true, excluded, files); err != nil {
+			return "", err
+		}
+	}
+	for _, dir := range in.Dirs {
+		if err := in.walk(dir, false, excluded, files); err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s\noperation %s\n", keyVersion, operation)
+	for _, kv := range sorted(in.Env) {
+		fmt.Fprintf(h, "env %s\n", kv)
+	}
+	for _, tool := range sorted(in.Tools) {
+		fmt.Fprintf(h, "tool %s\n", tool)
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		sum, mode, err := hashFile(filepath.Join(in.Root, filepath.FromSlash(p)))
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(h, "file %s missing\n", p)
+		case err != nil:
+			return "", err
+		default:
+			fmt.Fprintf(h, "file %s %s %o\n", p, sum, mode)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// walk adds the regular files under dir to files, descending into subdirs
+// when recursive. Hidden dirs (the cache among them) and node_modules never
+// count; vendor does, since it is what a -mod=vendor build compiles.
+func (in Inputs) walk(dir string, recursive bool, excluded, files map[string]bool) error {
+	root := filepath.Join(in.Root, filepath.FromSlash(dir))
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(in.Root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if p == root {
+				return nil
+			}
+			name := d.Name()
+			if !recursive || strings.HasPrefix(name, ".") || name == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || excluded[rel] {
+			return nil
+		}
+		files[rel] = true
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func hashFile(p string) (string, os.FileMode, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), info.Mode().Perm(), nil
+}
+
+func sorted(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
+
+var (
+	toolMu       sync.Mutex
+	toolVersions = map[string]string{}
+)
+
+// ToolVersion returns "<name> <first line of output>" for `name args...`,
+// or "<name> unavailable". Results are memoized per process.
+func ToolVersion(name string, args ...string) string {
+	id := strings.Join(append([]string{name}, args...), " ")
+
+	toolMu.Lock()
+	defer toolMu.Unlock()
+	if v, ok := toolVersions[id]; ok {
+		return v
+	}
+
+	v := name + " unavailable"
+	if out, err := runner.Command(runner.Context(), name, args...).Output(); err == nil {
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		v = name + " " + line
+	}
+	toolVersions[id] = v
+	return v
+}
+
+// Env returns KEY=VALUE for each of keys set in the environment.
+func Env(keys ...string) []string {
+	var env []string
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
+}
@@ -0,0 +1,391 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// ErrNotFound is returned by a Backend that has nothing stored under a key.
+var ErrNotFound = errors.New("cache entry not found")
+
+// Backend is a shared store of cache entries, each an opaque blob (a tar.gz
+// of the entry) under its key.
+type Backend interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, blob []byte) error
+	String() string
+}
+
+// ChecksumHeader carries the sha256 of an uploaded blob, for servers that
+// want to check what they store.
+const ChecksumHeader = "X-Checksum-Sha256"
+
+// HTTPBackend talks to any server that stores blobs with PUT /<key> and
+// returns them with GET /<key> (404 when missing).
+type HTTPBackend struct {
+	BaseURL string
+	Token   string       // sent as a bearer token when set
+	Client  *http.Client // http.DefaultClient when nil
+}
+
+func (b *HTTPBackend) String() string { return b.BaseURL }
+
+func (b *HTTPBackend) client() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
+
+func (b *HTTPBackend) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(b.BaseURL, "/")+"/"+key, r)
+	if err != nil {
+		return nil, err
+	}
+	if b.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Token)
+	}
+	return req, nil
+}
+
+func (b *HTTPBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := b.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+}
+
+func (b *HTTPBackend) Put(ctx context.Context, key string, blob []byte) error {
+	req, err := b.request(ctx, http.MethodPut, key, blob)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(blob)
+	req.Header.Set(ChecksumHeader, hex.EncodeToString(sum[:]))
+	req.Header.Set("Content-Type", "application/gzip")
+	req.ContentLength = int64(len(blob))
+
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+// DirBackend keeps blobs in a dir, e.g. a volume shared between runners:
+// <Dir>/<key[:2]>/<key>.tar.gz.
+type DirBackend struct {
+	Dir string
+}
+
+func (b *DirBackend) String() string { return b.Dir }
+
+func (b *DirBackend) blobPath(key string) string {
+	return filepath.Join(b.Dir, key[:2], key+".tar.gz")
+}
+
+func (b *DirBackend) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(b.blobPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (b *DirBackend) Put(_ context.Context, key string, blob []byte) error {
+	p := b.blobPath(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// Write aside and rename, so concurrent runners never read half a blob.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Remote is the shared backend of a cache.
+type Remote struct {
+	Backend Backend
+	Push    bool          // upload new entries; off for read-only jobs
+	Timeout time.Duration // per request; 0 means none
+}
+
+// ResolveRemote returns the remote from config 'cache.remote' or
+// FLOW_CACHE_REMOTE, or nil when none is set. An http(s) URL selects the
+// HTTP backend, with 'cache.token'/FLOW_CACHE_TOKEN as bearer token; a path
+// or file:// URL the dir backend. Pushing is on unless 'cache.remote_push' or
+// FLOW_CACHE_REMOTE_PUSH is false.
+func ResolveRemote(flagVal string) (*Remote, error) {
+	remote := utils.ResolveStringValue(flagVal, "cache.remote", "FLOW_CACHE_REMOTE")
+	if remote == "" {
+		return nil, nil
+	}
+
+	r := &Remote{Push: true, Timeout: time.Minute}
+	if v := utils.ResolveStringValue("", "cache.remote_push", "FLOW_CACHE_REMOTE_PUSH"); v != "" {
+		push, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache.remote_push %q: %w", v, err)
+		}
+		r.Push = push
+	}
+
+	switch {
+	case strings.HasPrefix(remote, "http://"), strings.HasPrefix(remote, "https://"):
+		r.Backend = &HTTPBackend{
+			BaseURL: remote,
+			Token:   utils.ResolveStringValue("", "cache.token", "FLOW_CACHE_TOKEN"),
+		}
+	case strings.HasPrefix(remote, "file://"):
+		r.Backend = &DirBackend{Dir: strings.TrimPrefix(remote, "file://")}
+	case strings.Contains(remote, "://"):
+		return nil, fmt.Errorf("unsupported cache remote %q (expected http(s)://, file:// or a path)", remote)
+	default:
+		r.Backend = &DirBackend{Dir: remote}
+	}
+	return r, nil
+}
+
+func (r *Remote) context() (context.Context, context.CancelFunc) {
+	if r.Timeout > 0 {
+		return context.WithTimeout(context.Background(), r.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// fetch downloads key into the local cache. It returns nil when the remote
+// has no such entry.
+func (c *Cache) fetch(key string) (*Entry, error) {
+	ctx, cancel := c.Remote.context()
+	defer cancel()
+
+	body, err := c.Remote.Backend.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(c.Dir, ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extract(body, tmp); err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", key, err)
+	}
+	e, err := verify(tmp, key)
+	if err != nil {
+		return nil, fmt.Errorf("rejected %s from %s: %w", key, c.Remote.Backend, err)
+	}
+
+	final := c.entryDir(key)
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		return nil, err
+	}
+	_ = os.RemoveAll(final)
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// push uploads the local entry of key, after checking it is intact.
+func (c *Cache) push(key string) error {
+	dir := c.entryDir(key)
+	if _, err := verify(dir, key); err != nil {
+		return fmt.Errorf("refusing to upload %s: %w", key, err)
+	}
+	blob, err := archive(dir)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s: %w", key, err)
+	}
+
+	ctx, cancel := c.Remote.context()
+	defer cancel()
+	return c.Remote.Backend.Put(ctx, key, blob)
+}
+
+// verify checks that the entry in dir is stored under key and that every
+// output matches its recorded checksum.
+func verify(dir, key string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, entryFile))
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Key != key {
+		return nil, fmt.Errorf("entry is for key %s", e.Key)
+	}
+	for _, out := range e.Outputs {
+		if err := checkLocal(out); err != nil {
+			return nil, err
+		}
+		want, ok := e.Checksums[out]
+		if !ok {
+			return nil, fmt.Errorf("no checksum for output %s", out)
+		}
+		got, _, err := hashFile(filepath.Join(dir, outputsDir, filepath.FromSlash(out)))
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, fmt.Errorf("output %s has sha256 %s, want %s", out, got, want)
+		}
+	}
+	return &e, nil
+}
+
+// archive returns dir as a tar.gz of its regular files.
+func archive(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extract unpacks the tar.gz r into dir, rejecting paths that escape it.
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := checkLocal(hdr.Name); err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(path.Clean(hdr.Name)))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkLocal rejects a slash-separated path from an entry or archive that is
+// absolute or escapes the dir it is joined to.
+func checkLocal(name string) error {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return fmt.Errorf("invalid path %q", name)
+	}
+	return nil
+}
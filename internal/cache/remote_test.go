@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testToken = "s3cret"
+
+// blobServer is a minimal HTTP cache backend: PUT/GET /<key> with a bearer
+// token, 404 for unknown keys.
+type blobServer struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newBlobServer(t *testing.T) (*blobServer, *httptest.Server) {
+	s := &blobServer{blobs: make(map[string][]byte)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			blob, _ := io.ReadAll(r.Body)
+			sum := sha256.Sum256(blob)
+			if r.Header.Get(ChecksumHeader) != hex.EncodeToString(sum[:]) {
+				http.Error(w, "checksum mismatch", http.StatusBadRequest)
+				return
+			}
+			s.blobs[key] = blob
+		case http.MethodGet:
+			blob, ok := s.blobs[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func newRemoteCache(t *testing.T, url, token string, stderr io.Writer) *Cache {
+	c := New(t.TempDir())
+	c.Stderr = stderr
+	c.Remote = &Remote{Backend: &HTTPBackend{BaseURL: url, Token: token}, Push: true}
+	return c
+}
+
+func TestHTTPRemoteRoundTrip(t *testing.T) {
+	s, srv := newBlobServer(t)
+	key := strings.Repeat("ab", 32)
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "app"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var warnings bytes.Buffer
+	a := newRemoteCache(t, srv.URL, testToken, &warnings)
+	if err := a.Store(Entry{Key: key, Target: "service/app", Operation: "build", Outputs: []string{"app"}}, src); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if _, ok := s.blobs[key]; !ok {
+		t.Fatalf("Store did not PUT %s (warnings: %s)", key, warnings.String())
+	}
+
+	b := newRemoteCache(t, srv.URL, testToken, &warnings)
+	e, err := b.Lookup(key)
+	if err != nil || e == nil {
+		t.Fatalf("Lookup = %v, %v; want a remote hit (warnings: %s)", e, err, warnings.String())
+	}
+	dst := t.TempDir()
+	if err := b.Restore(e, dst); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "app"))
+	if err != nil || string(got) != "binary" {
+		t.Fatalf("restored output = %q, %v; want %q", got, err, "binary")
+	}
+}
+
+func TestHTTPRemoteMissIsNotAnError(t *testing.T) {
+	_, srv := newBlobServer(t)
+	var warnings bytes.Buffer
+	c := newRemoteCache(t, srv.URL, testToken, &warnings)
+
+	e, err := c.Lookup(strings.Repeat("cd", 32))
+	if e != nil || err != nil {
+		t.Fatalf("Lookup = %v, %v; want a miss", e, err)
+	}
+	if warnings.Len() > 0 {
+		t.Fatalf("a 404 should be a silent miss, got warning %q", warnings.String())
+	}
+}
+
+func TestHTTPRemoteRequiresToken(t *testing.T) {
+	_, srv := newBlobServer(t)
+	b := &HTTPBackend{BaseURL: srv.URL, Token: "wrong"}
+
+	if err := b.Put(t.Context(), "ef", []byte("blob")); err == nil {
+		t.Fatal("Put with a wrong token succeeded")
+	}
+	if _, err := b.Get(t.Context(), "ef"); err == nil || err == ErrNotFound {
+		t.Fatalf("Get with a wrong token = %v, want an auth error", err)
+	}
+}
+
+// tamperedBlob packs an entry for key that records output name with
+// checksum, while the archive holds content under outputs/app.
+func tamperedBlob(t *testing.T, key, name, content, checksum string) []byte {
+	dir := t.TempDir()
+	e := Entry{Key: key, Outputs: []string{name}, Checksums: map[string]string{name: checksum}}
+	data, _ := json.Marshal(e)
+	if err := os.WriteFile(filepath.Join(dir, entryFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, outputsDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, outputsDir, "app"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := archive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestHTTPRemoteRejectsChecksumMismatch(t *testing.T) {
+	s, srv := newBlobServer(t)
+	key := strings.Repeat("12", 32)
+	sum := sha256.Sum256([]byte("original"))
+	s.blobs[key] = tamperedBlob(t, key, "app", "tampered", hex.EncodeToString(sum[:]))
+
+	var warnings bytes.Buffer
+	c := newRemoteCache(t, srv.URL, testToken, &warnings)
+	e, err := c.Lookup(key)
+	if e != nil || err != nil {
+		t.Fatalf("Lookup = %v, %v; want the entry rejected as a miss", e, err)
+	}
+	if !strings.Contains(warnings.String(), "rejected") {
+		t.Fatalf("warning = %q, want a rejection", warnings.String())
+	}
+	if _, err := os.Stat(c.EntryDir(key)); !os.IsNotExist(err) {
+		t.Fatalf("rejected entry was kept locally: %v", err)
+	}
+}
+
+func TestHTTPRemoteRejectsEscapingOutputs(t *testing.T) {
+	s, srv := newBlobServer(t)
+	key := strings.Repeat("34", 32)
+	sum := sha256.Sum256([]byte("x"))
+	s.blobs[key] = tamperedBlob(t, key, "../../app", "x", hex.EncodeToString(sum[:]))
+
+	var warnings bytes.Buffer
+	c := newRemoteCache(t, srv.URL, testToken, &warnings)
+	if e, _ := c.Lookup(key); e != nil {
+		t.Fatal("Lookup accepted an entry whose output escapes the entry dir")
+	}
+	if err := c.Restore(&Entry{Key: key, Outputs: []string{"../app"}}, t.TempDir()); err == nil {
+		t.Fatal("Restore accepted an output outside the target dir")
+	}
+}
@@ -1,5 +1,8 @@
 package common
 
+const IgnoreFile = ".flowignore"
+const TargetManifestFile = "flow.target.yaml"
+
 const ZeroCommit = "0000000000000000000000000000000000000000"
 const EmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
 
@@ -12,4 +15,5 @@ const (
 	FlagSrcDir          = "src-dir"
 	FlagFunctionsSubDir = "functions-subdir"
 	FlagServicesSubDir  = "services-subdir"
+	FlagDryRun          = "dry-run"
 )
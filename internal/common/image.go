@@ -0,0 +1,78 @@
+package common
+
+import "fmt"
+
+// ImageSettings are the resolved image and cloud settings shared by all targets.
+type ImageSettings struct {
+	Tag           string
+	Repository    string
+	BuildMethod   string
+	CloudProvider string
+	GCPRegion     string
+	GCPProjectId  string
+	AWSRegion     string
+	AWSAccountId  string
+	AZURERegistry string
+	NameInPath    bool // aws/azure: push to <repository>/<image name>
+}
+
+// ResolveImageSettings resolves every image and cloud setting from config and
+// env. Set fields of flags win.
+func ResolveImageSettings(flags ImageSettings) ImageSettings {
+	return ImageSettings{
+		Tag:           ResolveImageTag(flags.Tag),
+		Repository:    ResolveImageRepository(flags.Repository),
+		BuildMethod:   ResolveImageBuildMethod(flags.BuildMethod),
+		CloudProvider: ResolveCloudProvider(flags.CloudProvider),
+		GCPRegion:     ResolveGCPRegion(flags.GCPRegion),
+		GCPProjectId:  ResolveGCPProjectId(flags.GCPProjectId),
+		AWSRegion:     ResolveAWSRegion(flags.AWSRegion),
+		AWSAccountId:  ResolveAWSAccountId(flags.AWSAccountId),
+		AZURERegistry: ResolveAzureRegistry(flags.AZURERegistry),
+		NameInPath:    ResolveImageNameInPath(flags.NameInPath),
+	}
+}
+
+// MethodFor is the build method of t: its manifest's, else the configured one.
+func (s ImageSettings) MethodFor(t Target) string {
+	if t.Manifest != nil && t.Manifest.Build.Method != "" {
+		return t.Manifest.Build.Method
+	}
+	return s.BuildMethod
+}
+
+// ImageReference returns the image t is tagged with when built with method,
+// or "" when method builds no image or the provider settings are incomplete.
+func (s ImageSettings) ImageReference(t Target, method string) string {
+	name := t.ImageName()
+	switch {
+	case method == "local":
+		return fmt.Sprintf("local/%s:%s", name, s.Tag)
+	case s.CloudProvider == "gcp" && (method == "docker" || method == "cloud-build"):
+		if s.GCPRegion == "" || s.GCPProjectId == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s-docker.pkg.dev/%s/%s/%s:%s", s.GCPRegion, s.GCPProjectId, s.Repository, name, s.Tag)
+	case s.CloudProvider == "aws" && method == "docker":
+		if s.AWSAccountId == "" || s.AWSRegion == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:%s", s.AWSAccountId, s.AWSRegion, s.repositoryPath(name), s.Tag)
+	case s.CloudProvider == "azure" && method == "docker":
+		if s.AZURERegistry == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s.azurecr.io/%s:%s", s.AZURERegistry, s.repositoryPath(name), s.Tag)
+	}
+	return ""
+}
+
+// repositoryPath is the aws/azure repository an image is pushed to: the
+// configured one, shared by every target, or <repository>/<name> when
+// NameInPath is set.
+func (s ImageSettings) repositoryPath(name string) string {
+	if s.NameInPath {
+		return s.Repository + "/" + name
+	}
+	return s.Repository
+}
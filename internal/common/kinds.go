@@ -0,0 +1,312 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+const ScopeAll = "all"
+
+// Kind is a named group of targets that live as folders under a common root.
+type Kind struct {
+	Name       string
+	Path       string            // relative to the project root
+	Invalidate []string          // globs that mark every target of the kind as changed
+	Markers    []string          // files that mark a nested dir as a target, e.g. go.mod
+	Depth      int               // how deep below Path targets are searched
+	Labels     map[string]string // labels of every target of the kind
+}
+
+// kindConfig mirrors a single entry of the `kinds:` section in flow.yaml.
+type kindConfig struct {
+	Path       string            `mapstructure:"path"`
+	Invalidate []string          `mapstructure:"invalidate"`
+	Markers    []string          `mapstructure:"markers"`
+	Depth      int               `mapstructure:"depth"`
+	Labels     map[string]string `mapstructure:"labels"`
+}
+
+// Discovery returns how the kind's targets are found below its root.
+func (k Kind) Discovery() utils.TargetDiscovery {
+	return utils.TargetDiscovery{Markers: k.Markers, Depth: k.Depth}
+}
+
+// ResolveKinds returns the kinds defined under `kinds:` in config, sorted by
+// name. When no kinds are configured, the legacy `function` and `service`
+// kinds are derived from dirs.src and dirs.{functions,services}_subdir.
+//
+// discovery.markers and discovery.depth apply to every kind that doesn't set
+// its own markers or depth.
+func ResolveKinds(srcDir, funcSub, svcSub string) ([]Kind, error) {
+	var configured map[string]kindConfig
+	if err := viper.UnmarshalKey("kinds", &configured); err != nil {
+		return nil, fmt.Errorf("failed to parse kinds config: %w", err)
+	}
+
+	markers := viper.GetStringSlice("discovery.markers")
+	depth := viper.GetInt("discovery.depth")
+	if depth < 0 {
+		return nil, fmt.Errorf("discovery.depth must not be negative")
+	}
+
+	if len(configured) == 0 {
+		srcDir = ResolveSrcDir(srcDir)
+		return []Kind{
+			{Name: "function", Path: filepath.Join(srcDir, ResolveFunctionsDir(funcSub)), Markers: markers, Depth: depth},
+			{Name: "service", Path: filepath.Join(srcDir, ResolveServicesDir(svcSub)), Markers: markers, Depth: depth},
+		}, nil
+	}
+
+	kinds := make([]Kind, 0, len(configured))
+	for name, kc := range configured {
+		if name == ScopeAll {
+			return nil, fmt.Errorf("kind name %q is reserved", ScopeAll)
+		}
+		if kc.Path == "" {
+			return nil, fmt.Errorf("kind %q has no path", name)
+		}
+		if kc.Depth < 0 {
+			return nil, fmt.Errorf("kind %q has a negative depth", name)
+		}
+		if len(kc.Markers) == 0 {
+			kc.Markers = markers
+		}
+		if kc.Depth == 0 {
+			kc.Depth = depth
+		}
+		kinds = append(kinds, Kind{
+			Name:       name,
+			Path:       filepath.Clean(kc.Path),
+			Invalidate: kc.Invalidate,
+			Markers:    kc.Markers,
+			Depth:      kc.Depth,
+			Labels:     kc.Labels,
+		})
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Name < kinds[j].Name })
+	return kinds, nil
+}
+
+// SelectKinds filters kinds by scope, which is "all", a kind name or a
+// comma-separated list of kind names.
+func SelectKinds(kinds []Kind, scope string) ([]Kind, error) {
+	if scope == ScopeAll {
+		return kinds, nil
+	}
+
+	byName := make(map[string]Kind, len(kinds))
+	names := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		byName[k.Name] = k
+		names = append(names, k.Name)
+	}
+
+	var selected []Kind
+	seen := make(map[string]struct{})
+	for _, name := range strings.Split(scope, ",") {
+		name = strings.TrimSpace(name)
+		k, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid scope: %q (expected: %s|%s)", name, strings.Join(names, "|"), ScopeAll)
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		selected = append(selected, k)
+	}
+	return selected, nil
+}
+
+// ResolveScopeKinds resolves the configured kinds and filters them by scope.
+func ResolveScopeKinds(scope, srcDir, funcSub, svcSub string) ([]Kind, error) {
+	kinds, err := ResolveKinds(srcDir, funcSub, svcSub)
+	if err != nil {
+		return nil, err
+	}
+	return SelectKinds(kinds, scope)
+}
+
+// Target is a target dir discovered under a kind root.
+type Target struct {
+	Kind     string
+	Name     string          // path relative to the kind root, e.g. payments/ledger-api
+	Dir      string          // absolute path
+	Manifest *TargetManifest // flow.target.yaml, nil when the target has none
+	Labels   map[string]string
+}
+
+// ID is the target's "<kind>/<name>" key, as used by get changed.
+func (t Target) ID() string {
+	return t.Kind + "/" + t.Name
+}
+
+// ImageName is the manifest image, or the target name flattened for image
+// tags and build args, e.g. payments-ledger-api.
+func (t Target) ImageName() string {
+	if t.Manifest != nil && t.Manifest.Image != "" {
+		return t.Manifest.Image
+	}
+	return strings.ReplaceAll(t.Name, "/", "-")
+}
+
+// Language is the manifest language, or the one detected from the target dir.
+func (t Target) Language() string {
+	if t.Manifest != nil && t.Manifest.Language != "" {
+		return t.Manifest.Language
+	}
+	return utils.DetectLanguage(t.Dir)
+}
+
+// Timeout is the manifest timeout, or 0 to use --target-timeout.
+func (t Target) Timeout() time.Duration {
+	if t.Manifest == nil || t.Manifest.Timeout == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(t.Manifest.Timeout) // checked on load
+	return d
+}
+
+// LoadTarget builds the target named name of kind k, reading its manifest.
+// The manifest must not claim a different kind.
+func LoadTarget(projectRoot string, k Kind, name string) (Target, error) {
+	t := Target{Kind: k.Name, Name: name, Dir: filepath.Join(projectRoot, k.Path, filepath.FromSlash(name))}
+
+	m, err := LoadTargetManifest(t.Dir)
+	if err != nil {
+		return t, err
+	}
+	if m != nil && m.Kind != "" && m.Kind != k.Name {
+		return t, fmt.Errorf("%s of %s declares kind %q but the target lives under kind %q", TargetManifestFile, name, m.Kind, k.Name)
+	}
+	t.Manifest = m
+	t.Labels = ResolveTargetLabels(k, name, m)
+	return t, nil
+}
+
+// ResolveTargetLabels merges the labels of a target: those of its kind, then
+// the `labels:` config entries whose "<kind>/<name>" glob matches it, then its
+// manifest's. Later sources win.
+func ResolveTargetLabels(k Kind, name string, m *TargetManifest) map[string]string {
+	labels := make(map[string]string)
+	for key, v := range k.Labels {
+		labels[key] = v
+	}
+
+	// viper lower-cases keys, so match target ids case-insensitively.
+	id := strings.ToLower(k.Name + "/" + name)
+	configured := viper.GetStringMap("labels")
+	patterns := make([]string, 0, len(configured))
+	for pattern := range configured {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns) // deterministic precedence between overlapping globs
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); !ok {
+			continue
+		}
+		entries, _ := configured[pattern].(map[string]any)
+		for key, v := range entries {
+			labels[key] = fmt.Sprint(v)
+		}
+	}
+
+	if m != nil {
+		for key, v := range m.Labels {
+			labels[key] = v
+		}
+	}
+	return labels
+}
+
+// FilterTargets keeps the targets whose labels match the selector.
+func FilterTargets(targets []Target, selector string) ([]Target, error) {
+	sel, err := utils.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	if sel.Empty() {
+		return targets, nil
+	}
+
+	var kept []Target
+	for _, t := range targets {
+		if sel.Matches(t.Labels) {
+			kept = append(kept, t)
+		}
+	}
+	return kept, nil
+}
+
+// ResolveKindTargets discovers the targets of every kind, or resolves the
+// named ones. A name is a path relative to the kind root or, when it is
+// unambiguous, the base name of a nested target. A name missing from some
+// kinds is fine; any other error, e.g. an invalid manifest, is returned.
+func ResolveKindTargets(projectRoot string, kinds []Kind, targets []string) ([]Target, error) {
+	if len(kinds) == 1 {
+		return kindTargets(projectRoot, kinds[0], targets)
+	}
+
+	var resolved []Target
+	if len(targets) == 0 {
+		for _, k := range kinds {
+			found, err := kindTargets(projectRoot, k, nil)
+			if err != nil {
+				return nil, fmt.Errorf("kind %s: %w", k.Name, err)
+			}
+			resolved = append(resolved, found...)
+		}
+		return resolved, nil
+	}
+
+	for _, t := range targets {
+		found := false
+		for _, k := range kinds {
+			match, err := kindTargets(projectRoot, k, []string{t})
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("kind %s: %w", k.Name, err)
+			}
+			resolved = append(resolved, match...)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("target %s does not exist under any selected kind", t)
+		}
+	}
+	return resolved, nil
+}
+
+func kindTargets(projectRoot string, k Kind, targets []string) ([]Target, error) {
+	root := filepath.Join(projectRoot, k.Path)
+	dirs, err := utils.FormAbsolutePathToDiscoveredTargetDirs(root, targets, k.Discovery())
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([]Target, 0, len(dirs))
+	for _, dir := range dirs {
+		name, err := filepath.Rel(root, dir)
+		if err != nil {
+			return nil, err
+		}
+		t, err := LoadTarget(projectRoot, k, filepath.ToSlash(name))
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, t)
+	}
+	return resolved, nil
+}
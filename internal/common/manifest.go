@@ -0,0 +1,121 @@
+package common
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// TargetManifest is the optional flow.target.yaml of a target. Unset fields
+// fall back to what flow infers from the target dir and the config.
+type TargetManifest struct {
+	Kind       string            `json:"kind,omitempty"`
+	Language   string            `json:"language,omitempty"`
+	Image      string            `json:"image,omitempty"`
+	Entrypoint string            `json:"entrypoint,omitempty"`
+	Build      ManifestBuild     `json:"build,omitempty"`
+	Watch      []string          `json:"watch,omitempty"`
+	DependsOn  []string          `json:"depends_on,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Test       ManifestTest      `json:"test,omitempty"`
+	Timeout    string            `json:"timeout,omitempty"` // Go duration, e.g. 15m
+}
+
+// ManifestTest is the `test:` section of a target manifest.
+type ManifestTest struct {
+	CoverageMin *float64 `json:"coverage_min,omitempty"` // percent; nil when unset
+}
+
+// ManifestBuild is the `build:` section of a target manifest.
+type ManifestBuild struct {
+	Method           string            `json:"method,omitempty"`
+	GOOS             string            `json:"goos,omitempty"`
+	GOARCH           string            `json:"goarch,omitempty"`
+	Platforms        []string          `json:"platforms,omitempty"` // os/arch pairs, built in one run
+	Args             map[string]string `json:"args,omitempty"`
+	CloudBuildConfig string            `json:"cloudbuild_config,omitempty"`
+}
+
+//go:embed target.schema.json
+var targetSchemaJSON []byte
+
+var targetSchema = sync.OnceValues(func() (*jsonschema.Resolved, error) {
+	var s jsonschema.Schema
+	if err := json.Unmarshal(targetSchemaJSON, &s); err != nil {
+		return nil, err
+	}
+	return s.Resolve(nil)
+})
+
+// TargetSchema returns the JSON schema flow.target.yaml is validated against.
+func TargetSchema() []byte {
+	return targetSchemaJSON
+}
+
+// LoadTargetManifest reads and validates the manifest in dir. A target
+// without a manifest yields nil.
+func LoadTargetManifest(dir string) (*TargetManifest, error) {
+	file := filepath.Join(dir, TargetManifestFile)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	m, err := ParseTargetManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", file, err)
+	}
+	return m, nil
+}
+
+// ParseTargetManifest decodes a manifest and validates it against the schema.
+func ParseTargetManifest(data []byte) (*TargetManifest, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return &TargetManifest{}, nil // empty file
+	}
+
+	// Round-trip through JSON so that the schema sees JSON types.
+	doc, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var instance any
+	if err := json.Unmarshal(doc, &instance); err != nil {
+		return nil, err
+	}
+
+	schema, err := targetSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest schema: %w", err)
+	}
+	if err := schema.Validate(instance); err != nil {
+		return nil, err
+	}
+
+	var m TargetManifest
+	if err := json.Unmarshal(doc, &m); err != nil {
+		return nil, err
+	}
+	if m.Timeout != "" {
+		if _, err := time.ParseDuration(m.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	return &m, nil
+}
@@ -1,6 +1,13 @@
 package common
 
 import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+
 	"github.com/selimacerbas/flow/internal/utils"
 )
 
@@ -19,6 +26,16 @@ func ResolveScope(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "scope", "FLOW_SCOPE")
 }
 
+// ResolveInvalidatePatterns returns the global globs that mark every target as changed.
+func ResolveInvalidatePatterns() []string {
+	return viper.GetStringSlice("invalidate")
+}
+
+// ResolveIgnorePatterns returns the repo-wide ignore globs from config.
+func ResolveIgnorePatterns() []string {
+	return viper.GetStringSlice("ignore")
+}
+
 func ResolveGitOwner(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "git.owner", "FLOW_GIT_OWNER")
 }
@@ -39,6 +56,14 @@ func ResolveGitBranch(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "git.branch", "FLOW_GIT_BRANCH")
 }
 
+func ResolveChangedFallback(flagVal string) string {
+	return utils.ResolveStringValue(flagVal, "changed.fallback", "FLOW_CHANGED_FALLBACK")
+}
+
+func ResolveChangedFallbackBranch(flagVal string) string {
+	return utils.ResolveStringValue(flagVal, "changed.fallback_branch", "FLOW_CHANGED_FALLBACK_BRANCH")
+}
+
 func ResolveAuthMethod(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "git.auth_method", "FLOW_AUTH_METHOD")
 }
@@ -51,6 +76,17 @@ func ResolveImageRepository(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "image.repository", "FLOW_IMAGE_REPOSITORY")
 }
 
+// ResolveImageNameInPath reports whether aws and azure images are pushed to
+// <repository>/<image name> rather than sharing <repository>, from the flag,
+// config 'image.name_in_path' or FLOW_IMAGE_NAME_IN_PATH.
+func ResolveImageNameInPath(flagVal bool) bool {
+	if flagVal {
+		return true
+	}
+	on, _ := strconv.ParseBool(utils.ResolveStringValue("", "image.name_in_path", "FLOW_IMAGE_NAME_IN_PATH"))
+	return on
+}
+
 func ResolveImageBuildMethod(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "image.build_method", "FLOW_IMAGE_BUILD_METHOD")
 }
@@ -78,3 +114,32 @@ func ResolveAWSRegion(flagVal string) string {
 func ResolveAzureRegistry(flagVal string) string {
 	return utils.ResolveStringValue(flagVal, "cloud.azure.registry", "FLOW_AZURE_REGISTRY")
 }
+
+// ResolveJobs returns the number of targets to process at once: the flag,
+// then config 'jobs' or FLOW_JOBS, then the CPU count.
+func ResolveJobs(flagVal int) int {
+	if flagVal > 0 {
+		return flagVal
+	}
+	if n, err := strconv.Atoi(utils.ResolveStringValue("", "jobs", "FLOW_JOBS")); err == nil && n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+// ResolveDuration returns the flag when set, then config key or env, parsed as
+// a Go duration. Unset means 0, no limit.
+func ResolveDuration(flagVal time.Duration, configKey, envVar string) (time.Duration, error) {
+	if flagVal > 0 {
+		return flagVal, nil
+	}
+	v := utils.ResolveStringValue("", configKey, envVar)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", configKey, v, err)
+	}
+	return d, nil
+}
@@ -1,24 +1,31 @@
 package common
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
-)
+	"io"
 
-func RunCustomCommand(targetDirs []string, command string) error {
-	for _, dir := range targetDirs {
-		fmt.Printf("Target directory: %s\n", dir)
-		fmt.Printf("Command: %s\n", command)
+	"github.com/selimacerbas/flow/internal/runner"
+)
 
-		cmd := exec.Command("sh", "-c", command)
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+// RunCustomCommand runs command with sh -c in every target.
+func RunCustomCommand(targets []Target, command string, opts runner.Options) ([]runner.Result, error) {
+	tasks := make([]runner.Task, 0, len(targets))
+	for _, t := range targets {
+		tasks = append(tasks, runner.Task{
+			Target:    t.ID(),
+			Operation: "custom",
+			Timeout:   t.Timeout(),
+			Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+				fmt.Fprintf(stdout, "Target directory: %s\n", t.Dir)
+				fmt.Fprintf(stdout, "Command: %s\n", command)
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("command failed in %s: %w", dir, err)
-		}
+				if err := runner.Exec(ctx, stdout, stderr, t.Dir, nil, "sh", "-c", command); err != nil {
+					return fmt.Errorf("command failed in %s: %w", t.Dir, err)
+				}
+				return nil
+			},
+		})
 	}
-	return nil
+	return runner.Run(tasks, opts)
 }
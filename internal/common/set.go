@@ -1,23 +1,30 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+
+	"github.com/selimacerbas/flow/internal/runner"
 )
 
+// gitConfigFile is what `git config --global` writes, for dry-run plans.
+const gitConfigFile = "~/.gitconfig"
+
 // expects comaseperated string
-func SetGitAuthSSH(hosts string) error {
+func SetGitAuthSSH(ctx context.Context, hosts string) error {
 
 	hostsList := strings.Split(hosts, ",")
 	for _, host := range hostsList {
-		fmt.Printf("Configuring SSH for %s\n", host)
-		cmd := exec.Command("git", "config", "--global", fmt.Sprintf("url.git@%s:.insteadOf", host), fmt.Sprintf("https://%s/", host))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		argv := []string{"git", "config", "--global", fmt.Sprintf("url.git@%s:.insteadOf", host), fmt.Sprintf("https://%s/", host)}
+		if p := runner.PlanFrom(ctx); p != nil {
+			p.Add(ctx, runner.Step{Operation: "git-auth", Argv: argv, Writes: []string{gitConfigFile}})
+			continue
+		}
 
-		if err := cmd.Run(); err != nil {
+		fmt.Printf("Configuring SSH for %s\n", host)
+		if err := runner.Exec(ctx, os.Stdout, os.Stderr, "", nil, argv[0], argv[1:]...); err != nil {
 			return fmt.Errorf("failed to run exec command for SSH %s: %w", host, err)
 		}
 	}
@@ -25,17 +32,21 @@ func SetGitAuthSSH(hosts string) error {
 }
 
 // expects comaseperated string
-func SetGitAuthHTTPS(hosts string, username, token string) error {
+func SetGitAuthHTTPS(ctx context.Context, hosts string, username, token string) error {
 
 	hostsList := strings.Split(hosts, ",")
 	for _, host := range hostsList {
-		fmt.Printf("Configuring HTTPS token auth for %s\n", host)
 		authURL := fmt.Sprintf("https://%s:%s@%s/", username, token, host)
-		cmd := exec.Command("git", "config", "--global", fmt.Sprintf("url.%s.insteadOf", authURL), fmt.Sprintf("https://%s/", host))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		argv := []string{"git", "config", "--global", fmt.Sprintf("url.%s.insteadOf", authURL), fmt.Sprintf("https://%s/", host)}
+		if p := runner.PlanFrom(ctx); p != nil {
+			// Plans get shared; never put the token in one.
+			argv[3] = fmt.Sprintf("url.https://%s:***@%s/.insteadOf", username, host)
+			p.Add(ctx, runner.Step{Operation: "git-auth", Argv: argv, Writes: []string{gitConfigFile}})
+			continue
+		}
 
-		if err := cmd.Run(); err != nil {
+		fmt.Printf("Configuring HTTPS token auth for %s\n", host)
+		if err := runner.Exec(ctx, os.Stdout, os.Stderr, "", nil, argv[0], argv[1:]...); err != nil {
 			return fmt.Errorf("failed to run exec command for HTTPS %s: %w", host, err)
 		}
 	}
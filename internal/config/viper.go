@@ -13,9 +13,12 @@ func SetDefaults() {
 	// paths
 	viper.SetDefault("dirs.src", "src")
 	viper.SetDefault("dirs.functions_subdir", "cloud-functions")
-	viper.SetDefault("dirs.containers_subdir", "cloud-runs")
-	// scope
+	viper.SetDefault("dirs.services_subdir", "cloud-runs")
+	// scope: a kind name (see `kinds:`), a comma-separated list or "all"
 	viper.SetDefault("scope", "function")
+	// change detection fallback when no usable last successful run exists
+	viper.SetDefault("changed.fallback", "merge-base")
+	viper.SetDefault("changed.fallback_branch", "main")
 	// Go defaults
 	viper.SetDefault("go.os", "linux")
 	viper.SetDefault("go.arch", "amd64")
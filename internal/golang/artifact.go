@@ -0,0 +1,216 @@
+package golang
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// DefaultOutputName is the binary name template used with --out-dir.
+const DefaultOutputName = "{{.Name}}{{.Ext}}"
+
+// DefaultPlatformOutputName is the name template of a target built for
+// several platforms.
+const DefaultPlatformOutputName = "{{.Name}}_{{.GOOS}}_{{.GOARCH}}{{.Ext}}"
+
+// ArtifactManifestFile is written to the output dir next to the binaries.
+const ArtifactManifestFile = "artifacts.json"
+
+// BuildInfo is the version information injected into binaries with
+// -ldflags -X. A variable the binary doesn't declare is left alone by the
+// linker, so injection is safe for every target.
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"` // RFC 3339
+
+	VersionVar string `json:"-"` // e.g. main.version
+	CommitVar  string `json:"-"`
+	DateVar    string `json:"-"`
+}
+
+// ResolveBuildVersion is the version to inject: the flag, config
+// 'go.build_version' or FLOW_BUILD_VERSION. Empty means use `git describe`.
+func ResolveBuildVersion(flagVal string) string {
+	return utils.ResolveStringValue(flagVal, "go.build_version", "FLOW_BUILD_VERSION")
+}
+
+// ResolveBuildDate is SOURCE_DATE_EPOCH, for reproducible builds, or now.
+func ResolveBuildDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC(), nil
+	}
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// ResolveLDFlagVars fills the variables of info from config
+// 'go.ldflags_vars.{version,commit,date}', defaulting to main.version,
+// main.commit and main.date.
+func ResolveLDFlagVars(info *BuildInfo) {
+	info.VersionVar = resolveVar("version")
+	info.CommitVar = resolveVar("commit")
+	info.DateVar = resolveVar("date")
+}
+
+func resolveVar(name string) string {
+	if v := viper.GetString("go.ldflags_vars." + name); v != "" {
+		return v
+	}
+	return "main." + name
+}
+
+// ldflags returns the -X flags of info. The date is left out of cache keys
+// so that a rebuild of unchanged inputs is a hit; the cached binary keeps
+// the date it was built with.
+func (i *BuildInfo) ldflags(withDate bool) []string {
+	if i == nil {
+		return nil
+	}
+	flags := []string{
+		"-X", i.VersionVar + "=" + i.Version,
+		"-X", i.CommitVar + "=" + i.Commit,
+	}
+	if withDate {
+		flags = append(flags, "-X", i.DateVar+"="+i.Date)
+	}
+	return flags
+}
+
+// OutputNameData is what a --name template can refer to.
+type OutputNameData struct {
+	Name    string // the target's image name, e.g. payments-ledger-api
+	Kind    string
+	Target  string // <kind>/<name>
+	GOOS    string
+	GOARCH  string
+	Version string
+	Ext     string // .exe for windows
+}
+
+// OutputPath renders the name template for b and joins it to dir.
+func OutputPath(tmpl, dir string, b GoBuild, version string) (string, error) {
+	t, err := template.New("name").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	data := OutputNameData{
+		Name:    b.Target.ImageName(),
+		Kind:    b.Target.Kind,
+		Target:  b.Target.ID(),
+		GOOS:    b.GOOS,
+		GOARCH:  b.GOARCH,
+		Version: version,
+	}
+	if b.GOOS == "windows" {
+		data.Ext = ".exe"
+	}
+	var name bytes.Buffer
+	if err := t.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	if strings.TrimSpace(name.String()) == "" || strings.Contains(name.String(), "..") {
+		return "", fmt.Errorf("name template %q renders %q for %s", tmpl, name.String(), b.Target.ID())
+	}
+	return filepath.Join(dir, filepath.FromSlash(name.String())), nil
+}
+
+// Artifact is a binary produced (or restored from the cache) by RunGoBuild.
+type Artifact struct {
+	Target string `json:"target"`
+	Path   string `json:"path"` // relative to the manifest
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Cached bool   `json:"cached,omitempty"`
+}
+
+// ArtifactManifest lists the artifacts of a build run, with the version
+// info injected into them, if any.
+type ArtifactManifest struct {
+	*BuildInfo
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+func newArtifact(b GoBuild, path string, cached bool) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{
+		Target: b.Target.ID(),
+		Path:   path,
+		GOOS:   b.GOOS,
+		GOARCH: b.GOARCH,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Cached: cached,
+	}, nil
+}
+
+// WriteArtifactManifest writes the artifacts as JSON to path, with their
+// paths relative to it.
+func WriteArtifactManifest(path string, info *BuildInfo, artifacts []Artifact) error {
+	m := ArtifactManifest{BuildInfo: info, Artifacts: make([]Artifact, 0, len(artifacts))}
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		if rel, err := filepath.Rel(base, a.Path); err == nil {
+			a.Path = filepath.ToSlash(rel)
+		}
+		m.Artifacts = append(m.Artifacts, a)
+	}
+	sort.Slice(m.Artifacts, func(i, j int) bool { return m.Artifacts[i].Path < m.Artifacts[j].Path })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// checkOutputs fails when two builds would write the same binary.
+func checkOutputs(builds []GoBuild) error {
+	seen := make(map[string]common.Target)
+	for _, b := range builds {
+		if b.Output == "" {
+			continue
+		}
+		if other, ok := seen[b.Output]; ok {
+			return fmt.Errorf("%s and %s both write %s; use a --name template that tells them apart", other.ID(), b.Target.ID(), b.Output)
+		}
+		seen[b.Output] = b.Target
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/lint"
+	"github.com/selimacerbas/flow/internal/runner"
+)
+
+// GoLintOptions configures RunGoLint.
+type GoLintOptions struct {
+	Root   string                  // project root findings are made relative to
+	Linter string                  // external linter command run after go vet, e.g. "staticcheck ./..."
+	Keep   func(lint.Finding) bool // e.g. only findings on changed lines; nil keeps all
+}
+
+// LinterName is the name findings of an external linter command carry: the
+// base name of its executable.
+func LinterName(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(fields[0])
+}
+
+// RunGoLint runs `go vet`, then the external linter if one is configured, in
+// every target. A target fails when a linter finds something or cannot run.
+func RunGoLint(targets []common.Target, lo GoLintOptions, opts runner.Options) ([]runner.Result, lint.Report, error) {
+	report := lint.Report{Linters: []string{"vet"}}
+	if lo.Linter != "" {
+		report.Linters = append(report.Linters, LinterName(lo.Linter))
+	}
+
+	var mu sync.Mutex
+	tasks := make([]runner.Task, 0, len(targets))
+	for _, t := range targets {
+		tasks = append(tasks, runner.Task{
+			Target:    t.ID(),
+			Operation: "lint",
+			Timeout:   t.Timeout(),
+			Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+				fmt.Fprintf(stdout, "Running `go vet -json ./...` in %s\n", t.Dir)
+				findings, err := runGoVet(ctx, t, lo.Root, stderr)
+				if err != nil {
+					return err
+				}
+				if lo.Linter != "" {
+					fmt.Fprintf(stdout, "Running `%s` in %s\n", lo.Linter, t.Dir)
+					more, err := runLinter(ctx, t, lo.Root, lo.Linter, stderr)
+					if err != nil {
+						return err
+					}
+					findings = append(findings, more...)
+				}
+				if runner.PlanFrom(ctx) != nil {
+					return nil
+				}
+
+				if lo.Keep != nil {
+					findings = lint.Filter(findings, lo.Keep)
+				}
+				mu.Lock()
+				report.Findings = append(report.Findings, findings...)
+				mu.Unlock()
+
+				fmt.Fprintf(stdout, "%d finding(s)\n", len(findings))
+				if len(findings) > 0 {
+					return fmt.Errorf("%d lint finding(s) in %s", len(findings), t.Dir)
+				}
+				return nil
+			},
+		})
+	}
+
+	results, err := runner.Run(tasks, opts)
+	lint.Sort(report.Findings)
+	return results, report, err
+}
+
+// vetDiagnostic is a diagnostic of `go vet -json`, which prints
+// {"<package>": {"<analyzer>": [diagnostic...]}} objects.
+type vetDiagnostic struct {
+	Posn    string `json:"posn"` // file:line:col
+	Message string `json:"message"`
+}
+
+func runGoVet(ctx context.Context, t common.Target, root string, stderr io.Writer) ([]lint.Finding, error) {
+	var out bytes.Buffer
+	if err := runner.Exec(ctx, &out, &out, t.Dir, nil, "go", "vet", "-json", "./..."); err != nil {
+		// With -json, diagnostics don't fail vet; build and type errors do.
+		stderr.Write(out.Bytes())
+		return nil, fmt.Errorf("go vet failed in %s: %w", t.Dir, err)
+	}
+
+	// Drop the "# package" headers between the JSON objects.
+	var doc bytes.Buffer
+	for _, l := range strings.SplitAfter(out.String(), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			doc.WriteString(l)
+		}
+	}
+
+	var findings []lint.Finding
+	dec := json.NewDecoder(&doc)
+	for {
+		var pkgs map[string]map[string]json.RawMessage
+		if err := dec.Decode(&pkgs); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			stderr.Write(out.Bytes())
+			return nil, fmt.Errorf("failed to parse go vet output in %s: %w", t.Dir, err)
+		}
+		for _, analyzers := range pkgs {
+			for analyzer, raw := range analyzers {
+				var diags []vetDiagnostic
+				if err := json.Unmarshal(raw, &diags); err != nil {
+					return nil, fmt.Errorf("go vet analyzer %s failed in %s: %s", analyzer, t.Dir, raw)
+				}
+				for _, d := range diags {
+					findings = append(findings, vetFinding(t, root, analyzer, d))
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// posnRe splits a vet position, file:line[:col].
+var posnRe = regexp.MustCompile(`^(.*?):(\d+)(?::(\d+))?$`)
+
+func vetFinding(t common.Target, root, analyzer string, d vetDiagnostic) lint.Finding {
+	f := lint.Finding{Target: t.ID(), Linter: "vet", Rule: analyzer, Message: d.Message}
+	file := d.Posn
+	if m := posnRe.FindStringSubmatch(d.Posn); m != nil {
+		file = m[1]
+		f.Line, _ = strconv.Atoi(m[2])
+		f.Column, _ = strconv.Atoi(m[3])
+	}
+	f.File = lint.RelPath(root, t.Dir, file)
+	return f
+}
+
+func runLinter(ctx context.Context, t common.Target, root, command string, stderr io.Writer) ([]lint.Finding, error) {
+	var out bytes.Buffer
+	err := runner.Exec(ctx, &out, &out, t.Dir, nil, "sh", "-c", command)
+	findings := lint.ParseLines(out.String(), LinterName(command), t.ID(), root, t.Dir)
+	// Linters exit non-zero when they find something; only an exit without
+	// findings means the linter itself failed.
+	if err != nil && (len(findings) == 0 || ctx.Err() != nil) {
+		stderr.Write(out.Bytes())
+		return nil, fmt.Errorf("%s failed in %s: %w", LinterName(command), t.Dir, err)
+	}
+	return findings, nil
+}
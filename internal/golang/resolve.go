@@ -1,7 +1,12 @@
 package golang
 
 import (
+	"fmt"
+	"os"
 	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
 
 	"github.com/selimacerbas/flow/internal/utils"
 )
@@ -26,3 +31,65 @@ func ResolveENVGoArch(flagGoArch string) string {
 	}
 	return runtime.GOARCH
 }
+
+// ResolveCGOEnabled returns "0", "1" or "" to inherit CGO_ENABLED, from the
+// flag, config 'go.cgo_enabled' or FLOW_CGO_ENABLED.
+func ResolveCGOEnabled(flagVal string) (string, error) {
+	switch val := utils.ResolveStringValue(flagVal, "go.cgo_enabled", "FLOW_CGO_ENABLED"); val {
+	case "":
+		return "", nil
+	case "0", "false":
+		return "0", nil
+	case "1", "true":
+		return "1", nil
+	default:
+		return "", fmt.Errorf("invalid cgo setting %q (expected 0 or 1)", val)
+	}
+}
+
+// Platform is a GOOS/GOARCH pair, written as linux/arm64.
+type Platform struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (p Platform) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+// ParsePlatforms parses os/arch pairs, given as separate values or
+// comma-separated, dropping duplicates.
+func ParsePlatforms(values []string) ([]Platform, error) {
+	var platforms []Platform
+	seen := make(map[Platform]bool)
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			goos, goarch, ok := strings.Cut(s, "/")
+			if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+				return nil, fmt.Errorf("invalid platform %q (expected os/arch, e.g. linux/arm64)", s)
+			}
+			p := Platform{GOOS: goos, GOARCH: goarch}
+			if !seen[p] {
+				seen[p] = true
+				platforms = append(platforms, p)
+			}
+		}
+	}
+	return platforms, nil
+}
+
+// ResolvePlatforms returns the platforms of the flag, config 'go.platforms'
+// or FLOW_GO_PLATFORMS; none means a single GOOS/GOARCH build.
+func ResolvePlatforms(flagVal []string) ([]Platform, error) {
+	if len(flagVal) > 0 {
+		return ParsePlatforms(flagVal)
+	}
+	if fromConfig := viper.GetStringSlice("go.platforms"); len(fromConfig) > 0 {
+		return ParsePlatforms(fromConfig)
+	}
+	return ParsePlatforms([]string{os.Getenv("FLOW_GO_PLATFORMS")})
+}
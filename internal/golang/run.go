@@ -1,68 +1,248 @@
 package golang
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/selimacerbas/flow/internal/cache"
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
 )
 
-func RunGoClean(targetsDir []string) error {
-	for _, dir := range targetsDir {
-		fmt.Println("Running go clean . in", dir)
-		cmd := exec.Command("go", "clean", ".")
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+func RunGoClean(targets []common.Target, opts runner.Options) ([]runner.Result, error) {
+	return runGo(targets, opts, "clean", "clean", ".")
+}
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run go clean . failed %s: %w", dir, err)
-		}
+func RunGoMod(targets []common.Target, opts runner.Options) ([]runner.Result, error) {
+	return runGo(targets, opts, "mod", "mod", "tidy")
+}
+
+func RunGoVendor(targets []common.Target, opts runner.Options) ([]runner.Result, error) {
+	return runGo(targets, opts, "vendor", "mod", "vendor")
+}
+
+// runGo runs `go <args>` in every target as operation.
+func runGo(targets []common.Target, opts runner.Options, operation string, args ...string) ([]runner.Result, error) {
+	tasks := make([]runner.Task, 0, len(targets))
+	for _, t := range targets {
+		tasks = append(tasks, runner.Task{
+			Target:    t.ID(),
+			Operation: operation,
+			Timeout:   t.Timeout(),
+			Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+				fmt.Fprintf(stdout, "Running `go %s` in %s\n", strings.Join(args, " "), t.Dir)
+				if err := runner.Exec(ctx, stdout, stderr, t.Dir, nil, "go", args...); err != nil {
+					return fmt.Errorf("go %s failed in %s: %w", strings.Join(args, " "), t.Dir, err)
+				}
+				return nil
+			},
+		})
 	}
-	return nil
+	return runner.Run(tasks, opts)
 }
-func RunGoMod(targetDirs []string) error {
-	for _, dir := range targetDirs {
-		fmt.Println("Running go mod tidy in", dir)
-		cmd := exec.Command("go", "mod", "tidy")
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run go mod tidy failed %s: %w", dir, err)
-		}
+// GoBuild is a single `go build` of a target.
+type GoBuild struct {
+	Target     common.Target
+	Package    string // package to build relative to the target dir, "." when empty
+	GOOS       string
+	GOARCH     string
+	Variant    string // e.g. linux/arm64 when the target is built for several platforms
+	Output     string // absolute binary path; "" lets go build name it in the target dir
+	TrimPath   bool
+	CGOEnabled string       // "0" or "1"; "" inherits CGO_ENABLED
+	LDFlags    string       // extra -ldflags
+	Info       *BuildInfo   // injected with -ldflags -X when set
+	Inputs     cache.Inputs // what the build depends on, used with a cache
+}
+
+// buildEnv is the environment, besides GOOS/GOARCH, that changes a build.
+var buildEnv = []string{"CGO_ENABLED", "GOFLAGS", "GOEXPERIMENT", "GOAMD64", "GOARM", "GOARM64", "GO386"}
+
+// env is the environment of b's `go build`.
+func (b GoBuild) env() []string {
+	env := []string{"GOOS=" + b.GOOS, "GOARCH=" + b.GOARCH}
+	if b.CGOEnabled != "" {
+		env = append(env, "CGO_ENABLED="+b.CGOEnabled)
 	}
-	return nil
+	return env
 }
 
-func RunGoVendor(targetsDir []string) error {
-	for _, dir := range targetsDir {
-		fmt.Printf("Running `go mod vendor` in %s\n", dir)
-		cmd := exec.Command("go", "mod", "vendor")
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+// flags are the `go build` flags of b, except -o.
+func (b GoBuild) flags(withDate bool) []string {
+	var flags []string
+	if b.TrimPath {
+		flags = append(flags, "-trimpath")
+	}
+	ldflags := b.Info.ldflags(withDate)
+	if b.LDFlags != "" {
+		ldflags = append(ldflags, b.LDFlags)
+	}
+	if len(ldflags) > 0 {
+		flags = append(flags, "-ldflags", strings.Join(ldflags, " "))
+	}
+	return flags
+}
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run go mod vendor in %s: %w", dir, err)
+// RunGoBuild runs the builds and returns the binaries they produced. With a
+// non-nil cache, a build whose inputs are unchanged restores its binary from
+// the cache and is reported as cached.
+func RunGoBuild(builds []GoBuild, c *cache.Cache, opts runner.Options) ([]runner.Result, []Artifact, error) {
+	if err := checkOutputs(builds); err != nil {
+		return nil, nil, err
+	}
+
+	// Binaries of a target's platform matrix may land in its own dir, where
+	// they'd be hashed as inputs of their siblings while being written.
+	outputs := make(map[string][]string)
+	for _, b := range builds {
+		if b.Output != "" {
+			outputs[b.Target.ID()] = append(outputs[b.Target.ID()], b.Output)
 		}
 	}
-	return nil
-}
 
-func RunGoBuild(targetDirs []string, goos, goarch string) error {
-	for _, dir := range targetDirs {
-		fmt.Printf("→ Building function in %s [GOOS=%s, GOARCH=%s]\n", dir, goos, goarch)
+	var mu sync.Mutex
+	var artifacts []Artifact
+	collect := func(b GoBuild, output string, cached bool) error {
+		if output == "" {
+			return nil // not a main package
+		}
+		a, err := newArtifact(b, output, cached)
+		if err != nil {
+			return fmt.Errorf("failed to checksum %s: %w", output, err)
+		}
+		mu.Lock()
+		artifacts = append(artifacts, a)
+		mu.Unlock()
+		return nil
+	}
+
+	tasks := make([]runner.Task, 0, len(builds))
+	for _, b := range builds {
+		pkg := b.Package
+		if pkg == "" {
+			pkg = "."
+		}
+		dir := b.Target.Dir
+		operation, label := "build", ""
+		if b.Variant != "" {
+			operation = "build " + b.Variant
+			label = b.Target.ID() + " " + b.Variant
+		}
+		tasks = append(tasks, runner.Task{
+			Target:    b.Target.ID(),
+			Operation: operation,
+			Label:     label,
+			Timeout:   b.Target.Timeout(),
+			Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+				env := b.env()
+				dryRun := runner.PlanFrom(ctx) != nil
 
-		cmd := exec.Command("go", "build", ".")
-		cmd.Dir = dir
-		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+				var key string
+				output := b.Output
+				if c != nil {
+					var err error
+					if key, output, err = buildKey(ctx, b, pkg, env, outputs[b.Target.ID()]); err != nil {
+						fmt.Fprintf(stderr, "not caching %s: %v\n", b.Target.ID(), err)
+						key, output = "", b.Output
+					}
+				}
+				if key != "" {
+					e, err := c.Lookup(key)
+					if err != nil {
+						return err
+					}
+					if e != nil {
+						if err := c.Restore(e, filepath.Dir(output)); err != nil {
+							return err
+						}
+						fmt.Fprintf(stdout, "→ Cached %s in %s [GOOS=%s, GOARCH=%s]\n", pkg, dir, b.GOOS, b.GOARCH)
+						if err := collect(b, output, true); err != nil {
+							return err
+						}
+						return runner.ErrCached
+					}
+				}
 
+				fmt.Fprintf(stdout, "→ Building %s in %s [GOOS=%s, GOARCH=%s]\n", pkg, dir, b.GOOS, b.GOARCH)
+				if b.Output != "" && !dryRun {
+					if err := os.MkdirAll(filepath.Dir(b.Output), 0o755); err != nil {
+						return fmt.Errorf("failed to create output dir: %w", err)
+					}
+				}
+				args := append([]string{"build"}, b.flags(true)...)
+				if b.Output != "" {
+					args = append(args, "-o", b.Output)
+				}
+				args = append(args, pkg)
+				if err := runner.Exec(ctx, stdout, stderr, dir, env, "go", args...); err != nil {
+					return fmt.Errorf("go build failed in %s: %w", dir, err)
+				}
+				if dryRun {
+					return nil
+				}
+
+				if key != "" {
+					e := cache.Entry{Key: key, Target: b.Target.ID(), Operation: "build"}
+					if output != "" {
+						e.Outputs = []string{filepath.Base(output)}
+					}
+					if err := c.Store(e, filepath.Dir(output)); err != nil {
+						return err
+					}
+				}
+				return collect(b, output, false)
+			},
+		})
+	}
+	results, err := runner.Run(tasks, opts)
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return results, artifacts, err
+}
+
+// buildKey returns the cache key of b and the path of the binary it writes,
+// "" when pkg is not a main package. The binary and the other outputs of the
+// target are not inputs.
+func buildKey(ctx context.Context, b GoBuild, pkg string, env, outputs []string) (string, string, error) {
+	output := b.Output
+	if output == "" {
+		var out bytes.Buffer
+		cmd := runner.Command(ctx, "go", "list", "-f", "{{.Name}} {{.Target}}", pkg)
+		cmd.Dir = b.Target.Dir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = &out
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("go build failed in %s: %w", dir, err)
+			return "", "", fmt.Errorf("go list %s failed: %w", pkg, err)
+		}
+		name, target, _ := strings.Cut(strings.TrimSpace(out.String()), " ")
+		if name == "main" && target != "" {
+			output = filepath.Join(b.Target.Dir, filepath.Base(target))
 		}
 	}
-	return nil
+
+	in := b.Inputs
+	in.Env = append(append(append([]string(nil), in.Env...), env...), cache.Env(buildEnv...)...)
+	in.Env = append(in.Env, "PACKAGE="+pkg, "OUTPUT="+filepath.Base(output), "FLAGS="+strings.Join(b.flags(false), " "))
+	in.Tools = append(in.Tools, cache.ToolVersion("go", "version"))
+
+	in.Exclude = append([]string(nil), in.Exclude...)
+	for _, o := range append([]string{output}, outputs...) {
+		// Outputs may land among the inputs, e.g. in the target dir.
+		if rel, err := filepath.Rel(in.Root, o); o != "" && err == nil && !strings.HasPrefix(rel, "..") {
+			in.Exclude = append(in.Exclude, filepath.ToSlash(rel))
+		}
+	}
+
+	key, err := in.Key("go-build")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash inputs: %w", err)
+	}
+	return key, output, nil
 }
@@ -1,11 +1,18 @@
 package golang
 
 import (
+	"context"
 	"fmt"
 	"os"
+
+	"github.com/selimacerbas/flow/internal/runner"
 )
 
-func SetEnvGOPrivate(hosts string) error {
+func SetEnvGOPrivate(ctx context.Context, hosts string) error {
+	if p := runner.PlanFrom(ctx); p != nil {
+		p.Add(ctx, runner.Step{Operation: "setenv", Env: []string{"GOPRIVATE=" + hosts}})
+		return nil
+	}
 	if err := os.Setenv("GOPRIVATE", hosts); err != nil {
 		return fmt.Errorf("failed to set GOPRIVATE: %w", err)
 	}
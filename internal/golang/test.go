@@ -0,0 +1,554 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+)
+
+const (
+	TestPass = "pass"
+	TestFail = "fail"
+	TestSkip = "skip"
+)
+
+// GoTestOptions are the `go test` settings of a test run.
+type GoTestOptions struct {
+	Race        bool
+	Run         string // -run regexp
+	Short       bool
+	CoverageMin float64 // percent, unless a target manifest sets test.coverage_min; 0 means none
+}
+
+// TestCase is one test (or subtest) of a package.
+type TestCase struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"` // pass|fail|skip
+	Elapsed float64  `json:"elapsed"`
+	Output  []string `json:"output,omitempty"` // kept for failures only
+}
+
+// PackageResult aggregates the tests of one package.
+type PackageResult struct {
+	Target  string      `json:"target"`
+	Package string      `json:"package"`
+	Status  string      `json:"status"` // pass|fail|skip (no test files)
+	Elapsed float64     `json:"elapsed"`
+	Passed  int         `json:"passed"`
+	Failed  int         `json:"failed"`
+	Skipped int         `json:"skipped"`
+	Tests   []*TestCase `json:"tests,omitempty"`
+	Output  []string    `json:"output,omitempty"` // build errors and other package output
+}
+
+// TargetCoverage is the statement coverage of one target.
+type TargetCoverage struct {
+	Target     string  `json:"target"`
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+	Percent    float64 `json:"percent"`
+	Min        float64 `json:"min,omitempty"`
+}
+
+// TestReport collects the results of RunGoTest across targets.
+type TestReport struct {
+	mu       sync.Mutex
+	packages []*PackageResult
+	coverage []TargetCoverage
+	profile  *coverProfile
+}
+
+// Packages returns the package results, sorted by target and package.
+func (r *TestReport) Packages() []*PackageResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := append([]*PackageResult(nil), r.packages...)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Target != out[j].Target {
+			return out[i].Target < out[j].Target
+		}
+		return out[i].Package < out[j].Package
+	})
+	return out
+}
+
+// Coverage returns the coverage of every target, sorted by target.
+func (r *TestReport) Coverage() []TargetCoverage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := append([]TargetCoverage(nil), r.coverage...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+// RunGoTest runs `go test -json ./...` with a coverage profile in every
+// target. A target fails when a test or build fails, or when its coverage is
+// below its minimum.
+func RunGoTest(targets []common.Target, to GoTestOptions, opts runner.Options) ([]runner.Result, *TestReport, error) {
+	report := &TestReport{}
+	tmp, err := os.MkdirTemp("", "flow-test-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create coverage dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	mode := "set"
+	if to.Race {
+		mode = "atomic" // required by -race
+	}
+
+	tasks := make([]runner.Task, 0, len(targets))
+	for i, t := range targets {
+		profile := filepath.Join(tmp, strconv.Itoa(i)+".out")
+		args := []string{"test", "-json", "-covermode=" + mode, "-coverprofile=" + profile}
+		if to.Race {
+			args = append(args, "-race")
+		}
+		if to.Short {
+			args = append(args, "-short")
+		}
+		if to.Run != "" {
+			args = append(args, "-run", to.Run)
+		}
+		args = append(args, "./...")
+
+		min := to.CoverageMin
+		if t.Manifest != nil && t.Manifest.Test.CoverageMin != nil {
+			min = *t.Manifest.Test.CoverageMin
+		}
+
+		tasks = append(tasks, runner.Task{
+			Target:    t.ID(),
+			Operation: "test",
+			Timeout:   t.Timeout(),
+			Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+				fmt.Fprintf(stdout, "Running `go %s` in %s\n", strings.Join(args, " "), t.Dir)
+				events := newTestEventWriter(t.ID(), stdout, stderr)
+				err := runner.Exec(ctx, events, stderr, t.Dir, nil, "go", args...)
+				events.Flush()
+				report.addPackages(events.packages())
+				if runner.PlanFrom(ctx) != nil {
+					return nil
+				}
+				if err != nil {
+					err = fmt.Errorf("go test failed in %s: %w", t.Dir, err)
+				}
+
+				p, perr := readCoverProfile(profile)
+				if perr != nil {
+					if errors.Is(perr, os.ErrNotExist) {
+						return err // build failed before writing it
+					}
+					return errors.Join(err, fmt.Errorf("failed to read coverage of %s: %w", t.ID(), perr))
+				}
+				cov := p.coverage(t.ID())
+				cov.Min = min
+				report.addCoverage(cov, p)
+				fmt.Fprintf(stdout, "total coverage: %.1f%% of statements\n", cov.Percent)
+				if min > 0 && cov.Percent < min {
+					err = errors.Join(err, fmt.Errorf("coverage %.1f%% is below the minimum of %.1f%%", cov.Percent, min))
+				}
+				return err
+			},
+		})
+	}
+
+	results, err := runner.Run(tasks, opts)
+	return results, report, err
+}
+
+func (r *TestReport) addPackages(pkgs []*PackageResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packages = append(r.packages, pkgs...)
+}
+
+func (r *TestReport) addCoverage(c TargetCoverage, p *coverProfile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.coverage = append(r.coverage, c)
+	if r.profile == nil {
+		r.profile = newCoverProfile(p.mode)
+	}
+	r.profile.merge(p)
+}
+
+// WriteSummary writes a table of packages and one of target coverage.
+func (r *TestReport) WriteSummary(w io.Writer) error {
+	pkgs := r.Packages()
+	if len(pkgs) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tSTATUS\tPASS\tFAIL\tSKIP\tTIME")
+	for _, p := range pkgs {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.2fs\n", p.Package, p.Status, p.Passed, p.Failed, p.Skipped, p.Elapsed)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if cov := r.Coverage(); len(cov) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(tw, "TARGET\tCOVERAGE\tMIN")
+		for _, c := range cov {
+			min := "-"
+			if c.Min > 0 {
+				min = fmt.Sprintf("%.1f%%", c.Min)
+			}
+			fmt.Fprintf(tw, "%s\t%.1f%%\t%s\n", c.Target, c.Percent, min)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// WriteCoverProfile writes the coverage profiles of all targets merged into
+// one, as read by `go tool cover`.
+func (r *TestReport) WriteCoverProfile(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.profile
+	if p == nil {
+		p = newCoverProfile("set") // no target got far enough to record any
+	}
+	var buf bytes.Buffer
+	p.write(&buf)
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// junitSuites is the JUnit XML layout CI systems read: one suite per package.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the package results as JUnit XML. A package that failed
+// without a failing test (e.g. a build error) gets a synthetic failed case.
+func (r *TestReport) WriteJUnit(path string) error {
+	var doc junitSuites
+	for _, p := range r.Packages() {
+		s := junitSuite{
+			Name:       p.Package,
+			Time:       fmt.Sprintf("%.3f", p.Elapsed),
+			Properties: []junitProperty{{Name: "target", Value: p.Target}},
+		}
+		for _, tc := range p.Tests {
+			c := junitCase{Name: tc.Name, ClassName: p.Package, Time: fmt.Sprintf("%.3f", tc.Elapsed)}
+			switch tc.Status {
+			case TestFail:
+				c.Failure = &junitMessage{Message: "Failed", Body: strings.Join(tc.Output, "")}
+				s.Failures++
+			case TestSkip:
+				c.Skipped = &junitMessage{Message: "Skipped", Body: strings.Join(tc.Output, "")}
+				s.Skipped++
+			}
+			s.Cases = append(s.Cases, c)
+		}
+		if p.Status == TestFail && s.Failures == 0 {
+			s.Cases = append(s.Cases, junitCase{
+				Name: "[package]", ClassName: p.Package, Time: s.Time,
+				Failure: &junitMessage{Message: "Package failed", Body: strings.Join(p.Output, "")},
+			})
+			s.Failures++
+		}
+		s.Tests = len(s.Cases)
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+		doc.Skipped += s.Skipped
+		doc.Suites = append(doc.Suites, s)
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
+
+// testEvent is a line of `go test -json` (test2json) output.
+type testEvent struct {
+	Action     string  `json:"Action"`
+	Package    string  `json:"Package"`
+	ImportPath string  `json:"ImportPath"` // build-output and build-fail
+	Test       string  `json:"Test"`
+	Elapsed    float64 `json:"Elapsed"`
+	Output     string  `json:"Output"`
+}
+
+// testEventWriter decodes `go test -json` output of one target. It prints
+// what plain `go test` would, package lines and the output of failed tests,
+// and aggregates results per package.
+type testEventWriter struct {
+	target         string
+	stdout, stderr io.Writer
+	buf            bytes.Buffer
+	pkgs           map[string]*PackageResult
+	tests          map[string]*TestCase // "<package> <test>"
+	order          []string
+}
+
+func newTestEventWriter(target string, stdout, stderr io.Writer) *testEventWriter {
+	return &testEventWriter{
+		target: target,
+		stdout: stdout,
+		stderr: stderr,
+		pkgs:   make(map[string]*PackageResult),
+		tests:  make(map[string]*TestCase),
+	}
+}
+
+func (w *testEventWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		w.line(w.buf.Next(i + 1))
+	}
+	return len(b), nil
+}
+
+// Flush handles a trailing line without a newline.
+func (w *testEventWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.line(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *testEventWriter) pkg(name string) *PackageResult {
+	p, ok := w.pkgs[name]
+	if !ok {
+		p = &PackageResult{Target: w.target, Package: name}
+		w.pkgs[name] = p
+		w.order = append(w.order, name)
+	}
+	return p
+}
+
+func (w *testEventWriter) line(b []byte) {
+	var ev testEvent
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+	if err := json.Unmarshal(b, &ev); err != nil || ev.Action == "" {
+		w.stdout.Write(b) // not an event, e.g. output of a go command
+		return
+	}
+
+	switch ev.Action {
+	case "build-output":
+		fmt.Fprint(w.stderr, ev.Output)
+		// ImportPath is e.g. "example.com/pkg [example.com/pkg.test]".
+		name, _, _ := strings.Cut(ev.ImportPath, " ")
+		p := w.pkg(strings.TrimSuffix(name, ".test"))
+		p.Output = append(p.Output, ev.Output)
+		return
+	case "build-fail":
+		return // reported by the package's own fail event
+	}
+	if ev.Package == "" {
+		return
+	}
+	p := w.pkg(ev.Package)
+
+	if ev.Test == "" {
+		switch ev.Action {
+		case "output":
+			p.Output = append(p.Output, ev.Output)
+			if ev.Output != "PASS\n" {
+				fmt.Fprint(w.stdout, ev.Output)
+			}
+		case TestPass, TestFail, TestSkip:
+			p.Status = ev.Action
+			p.Elapsed = ev.Elapsed
+		}
+		return
+	}
+
+	key := ev.Package + " " + ev.Test
+	tc, ok := w.tests[key]
+	if !ok {
+		tc = &TestCase{Name: ev.Test}
+		w.tests[key] = tc
+		p.Tests = append(p.Tests, tc)
+	}
+	switch ev.Action {
+	case "output":
+		tc.Output = append(tc.Output, ev.Output)
+	case TestPass:
+		tc.Status, tc.Elapsed, tc.Output = TestPass, ev.Elapsed, nil
+		p.Passed++
+	case TestSkip:
+		tc.Status, tc.Elapsed = TestSkip, ev.Elapsed
+		p.Skipped++
+	case TestFail:
+		tc.Status, tc.Elapsed = TestFail, ev.Elapsed
+		p.Failed++
+		fmt.Fprint(w.stdout, strings.Join(tc.Output, ""))
+	}
+}
+
+func (w *testEventWriter) packages() []*PackageResult {
+	out := make([]*PackageResult, 0, len(w.order))
+	for _, name := range w.order {
+		p := w.pkgs[name]
+		if p.Status == "" {
+			p.Status = TestFail // no final event: the run was cut short
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// coverProfile is a parsed `go test -coverprofile` file.
+type coverProfile struct {
+	mode   string
+	blocks map[string]coverBlock // "file:startLine.startCol,endLine.endCol"
+}
+
+type coverBlock struct {
+	stmts, count int
+}
+
+func newCoverProfile(mode string) *coverProfile {
+	return &coverProfile{mode: mode, blocks: make(map[string]coverBlock)}
+}
+
+func readCoverProfile(path string) (*coverProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p *coverProfile
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if mode, ok := strings.CutPrefix(line, "mode: "); ok {
+			if p == nil {
+				p = newCoverProfile(mode)
+			}
+			continue
+		}
+		if p == nil {
+			return nil, fmt.Errorf("missing mode line")
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		stmts, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		p.add(fields[0], coverBlock{stmts, count})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = newCoverProfile("set")
+	}
+	return p, nil
+}
+
+// add records a block; a block seen twice (e.g. from two packages' runs)
+// keeps the higher count in set mode and the sum otherwise.
+func (p *coverProfile) add(key string, b coverBlock) {
+	old, ok := p.blocks[key]
+	switch {
+	case !ok:
+	case p.mode == "set":
+		b.count = max(b.count, old.count)
+	default:
+		b.count += old.count
+	}
+	p.blocks[key] = b
+}
+
+func (p *coverProfile) merge(o *coverProfile) {
+	for key, b := range o.blocks {
+		p.add(key, b)
+	}
+}
+
+func (p *coverProfile) coverage(target string) TargetCoverage {
+	c := TargetCoverage{Target: target}
+	for _, b := range p.blocks {
+		c.Statements += b.stmts
+		if b.count > 0 {
+			c.Covered += b.stmts
+		}
+	}
+	if c.Statements > 0 {
+		c.Percent = 100 * float64(c.Covered) / float64(c.Statements)
+	}
+	return c
+}
+
+func (p *coverProfile) write(w io.Writer) {
+	keys := make([]string, 0, len(p.blocks))
+	for k := range p.blocks {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "mode: %s\n", p.mode)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s %d %d\n", k, p.blocks[k].stmts, p.blocks[k].count)
+	}
+}
@@ -0,0 +1,188 @@
+// Package lint holds the findings model linters are parsed into and the
+// formats findings are reported in.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatSARIF  = "sarif"
+	FormatGitHub = "github"
+)
+
+// Formats lists the valid report formats.
+var Formats = []string{FormatText, FormatJSON, FormatSARIF, FormatGitHub}
+
+// Finding is a single diagnostic of a linter.
+type Finding struct {
+	Target  string `json:"target"`
+	Linter  string `json:"linter"`         // e.g. vet, staticcheck
+	Rule    string `json:"rule,omitempty"` // e.g. printf, SA4006
+	File    string `json:"file"`           // relative to the project root, slash-separated
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) ruleID() string {
+	if f.Rule == "" {
+		return f.Linter
+	}
+	return f.Linter + "/" + f.Rule
+}
+
+// RelPath makes file, absolute or relative to dir, relative to root.
+func RelPath(root, dir, file string) string {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	if rel, err := filepath.Rel(root, file); err == nil {
+		file = rel
+	}
+	return filepath.ToSlash(file)
+}
+
+// lineRe matches the "file:line[:col]: message" lines most linters print.
+var lineRe = regexp.MustCompile(`^(.+?\.[A-Za-z0-9]+):(\d+)(?::(\d+))?:\s*(.+)$`)
+
+// ruleRe matches a trailing "(rule)" as printed by staticcheck or
+// golangci-lint, e.g. "should omit nil check (S1031)".
+var ruleRe = regexp.MustCompile(`^(.*\S)\s+\(([\w./-]+)\)$`)
+
+// ParseLines reads "file:line[:col]: message" findings from linter output.
+// Paths are made relative to root, resolving relative ones against dir.
+// Lines that are not findings are ignored.
+func ParseLines(out, linter, target, root, dir string) []Finding {
+	var findings []Finding
+	for _, l := range strings.Split(out, "\n") {
+		m := lineRe.FindStringSubmatch(strings.TrimRight(l, "\r"))
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		f := Finding{
+			Target:  target,
+			Linter:  linter,
+			File:    RelPath(root, dir, m[1]),
+			Line:    line,
+			Column:  col,
+			Message: m[4],
+		}
+		if r := ruleRe.FindStringSubmatch(f.Message); r != nil {
+			f.Message, f.Rule = r[1], r[2]
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Report is the findings of a lint run, with every linter that ran, so
+// that a linter without findings still clears its code-scanning alerts.
+type Report struct {
+	Linters  []string  `json:"linters"`
+	Findings []Finding `json:"findings"`
+}
+
+// Filter keeps the findings keep returns true for.
+func Filter(findings []Finding, keep func(Finding) bool) []Finding {
+	var kept []Finding
+	for _, f := range findings {
+		if keep(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// Sort orders findings by file, position, linter and rule.
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.ruleID() < b.ruleID()
+	})
+}
+
+// Write prints the report in format: text, json, sarif or github.
+func Write(w io.Writer, r Report, format string) error {
+	switch format {
+	case FormatText:
+		return writeText(w, r.Findings)
+	case FormatJSON:
+		if r.Linters == nil {
+			r.Linters = []string{}
+		}
+		if r.Findings == nil {
+			r.Findings = []Finding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Report
+			Count int `json:"count"`
+		}{r, len(r.Findings)})
+	case FormatSARIF:
+		return writeSARIF(w, r)
+	case FormatGitHub:
+		return writeGitHub(w, r.Findings)
+	default:
+		return fmt.Errorf("invalid format: %q (expected: %s)", format, strings.Join(Formats, "|"))
+	}
+}
+
+func writeText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		pos := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if f.Column > 0 {
+			pos += ":" + strconv.Itoa(f.Column)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s (%s)\n", pos, f.Message, f.ruleID()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d finding(s)\n", len(findings))
+	return err
+}
+
+// writeGitHub prints workflow commands that GitHub Actions shows as
+// annotations on the pull request diff.
+func writeGitHub(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		props := fmt.Sprintf("file=%s,line=%d", escapeProperty(f.File), f.Line)
+		if f.Column > 0 {
+			props += fmt.Sprintf(",col=%d", f.Column)
+		}
+		props += ",title=" + escapeProperty(f.ruleID())
+		if _, err := fmt.Fprintf(w, "::error %s::%s\n", props, escapeData(f.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long a canceled command gets to exit after SIGTERM.
+const killGrace = 10 * time.Second
+
+var (
+	baseOnce sync.Once
+	baseCtx  context.Context
+	active   atomic.Int32 // Run calls in progress
+)
+
+// Context returns the process-wide context, canceled on the first SIGINT or
+// SIGTERM. Commands started from it are stopped. While tasks run, flow waits
+// for them to report; otherwise it exits right away. A second signal kills
+// flow in any case.
+func Context() context.Context {
+	baseOnce.Do(func() {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			stop()
+			if active.Load() == 0 {
+				time.Sleep(100 * time.Millisecond) // let canceled commands get their SIGTERM
+				os.Exit(130)
+			}
+			fmt.Fprintln(os.Stderr, "→ Interrupted, stopping running commands...")
+			// Backstop for callers that never look at the context again.
+			time.AfterFunc(killGrace+5*time.Second, func() { os.Exit(130) })
+		}()
+		baseCtx = ctx
+	})
+	return baseCtx
+}
+
+// Command returns cmd `name args...` bound to ctx: it is started in its own
+// process group and, when ctx is done, the whole group is stopped.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = killGrace + time.Second
+	return cmd
+}
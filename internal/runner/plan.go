@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Step is one side effect a command would have: a process it runs, env it
+// sets, an image it produces, or files it writes or removes.
+type Step struct {
+	Target    string   `json:"target,omitempty"`
+	Operation string   `json:"operation,omitempty"`
+	Dir       string   `json:"dir,omitempty"`
+	Argv      []string `json:"argv,omitempty"`
+	Env       []string `json:"env,omitempty"` // KEY=VALUE overrides
+	Image     string   `json:"image,omitempty"`
+	Writes    []string `json:"writes,omitempty"`
+	Removes   []string `json:"removes,omitempty"`
+}
+
+// Plan collects the steps of a dry run. A nil *Plan is valid and records
+// nothing, so callers can write PlanFrom(ctx).Add(ctx, step) unconditionally.
+type Plan struct {
+	mu    sync.Mutex
+	steps []Step
+}
+
+type planKey struct{}
+
+type scopeKey struct{}
+
+type scope struct {
+	target, operation string
+}
+
+// WithPlan returns ctx in dry-run mode: Exec records into p instead of
+// running anything.
+func WithPlan(ctx context.Context, p *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, p)
+}
+
+// PlanFrom returns the plan of a dry run, or nil when ctx is not one.
+func PlanFrom(ctx context.Context) *Plan {
+	p, _ := ctx.Value(planKey{}).(*Plan)
+	return p
+}
+
+func withScope(ctx context.Context, target, operation string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{target, operation})
+}
+
+// Add records s, taking its target and operation from the task running in
+// ctx unless set.
+func (p *Plan) Add(ctx context.Context, s Step) {
+	if p == nil {
+		return
+	}
+	if sc, ok := ctx.Value(scopeKey{}).(scope); ok {
+		if s.Target == "" {
+			s.Target = sc.target
+		}
+		if s.Operation == "" {
+			s.Operation = sc.operation
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, s)
+}
+
+// Steps returns the recorded steps in order.
+func (p *Plan) Steps() []Step {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Step(nil), p.steps...)
+}
+
+// WritePlan writes the steps of p as text or as {"steps": [...]} json.
+func WritePlan(w io.Writer, p *Plan, output string) error {
+	steps := p.Steps()
+	switch output {
+	case "json":
+		if steps == nil {
+			steps = []Step{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			DryRun bool   `json:"dry_run"`
+			Steps  []Step `json:"steps"`
+		}{true, steps})
+	case "text":
+		fmt.Fprintf(w, "Dry run: %d step(s), nothing was executed.\n", len(steps))
+		for i, s := range steps {
+			// Consecutive steps of one task share a header.
+			if i == 0 || s.Target != steps[i-1].Target || s.Operation != steps[i-1].Operation {
+				target := s.Target
+				if target == "" {
+					target = "-"
+				}
+				fmt.Fprintf(w, "\n[%s] %s\n", target, s.Operation)
+			}
+			if s.Dir != "" {
+				fmt.Fprintf(w, "    dir:    %s\n", s.Dir)
+			}
+			if len(s.Argv) > 0 {
+				fmt.Fprintf(w, "    run:    %s\n", quoteArgv(s.Argv))
+			}
+			if len(s.Env) > 0 {
+				fmt.Fprintf(w, "    env:    %s\n", strings.Join(s.Env, " "))
+			}
+			if s.Image != "" {
+				fmt.Fprintf(w, "    image:  %s\n", s.Image)
+			}
+			for _, f := range s.Writes {
+				fmt.Fprintf(w, "    writes: %s\n", f)
+			}
+			for _, f := range s.Removes {
+				fmt.Fprintf(w, "    removes: %s\n", f)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output: %q (expected: text|json)", output)
+}
+
+// quoteArgv joins argv for display, single-quoting args a shell would split.
+func quoteArgv(argv []string) string {
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"$&|;<>()*?`\\") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		out[i] = a
+	}
+	return strings.Join(out, " ")
+}
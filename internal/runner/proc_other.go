@@ -0,0 +1,9 @@
+//go:build !unix
+
+package runner
+
+import "os/exec"
+
+// setProcessGroup leaves cmd as is: without process groups, canceling kills
+// the process itself (exec.CommandContext's default).
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts cmd in its own process group and makes canceling it
+// stop the whole group: SIGTERM first, SIGKILL after killGrace unless Wait
+// has returned by then. Tools like `go build` and `docker build` spawn
+// children that would outlive a kill of the leader alone.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		err := syscall.Kill(-pgid, syscall.SIGTERM)
+		time.AfterFunc(killGrace, func() {
+			// Once Wait has reaped the leader the group may be gone and its
+			// pgid reused by an unrelated one, so only kill a live group.
+			if errors.Is(cmd.Process.Signal(syscall.Signal(0)), os.ErrProcessDone) {
+				return
+			}
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+}
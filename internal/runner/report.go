@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Report collects the results of a command's runs and ends the command the
+// way --keep-going, --output and the timeouts ask for.
+type Report struct {
+	KeepGoing     bool
+	Output        string        // text|json; json always prints a summary
+	Timeout       time.Duration // bounds the whole command; 0 means no limit
+	TargetTimeout time.Duration // bounds each task; 0 means no limit
+	DryRun        bool          // record a plan instead of running anything
+
+	results []Result
+	cancel  context.CancelFunc
+	plan    *Plan
+}
+
+// Options returns the runner options for the report's command. Every run
+// shares one context, canceled on SIGINT/SIGTERM or after r.Timeout.
+func (r *Report) Options(jobs int) Options {
+	ctx := Context()
+	if r.Timeout > 0 {
+		ctx, r.cancel = context.WithTimeout(ctx, r.Timeout)
+	}
+	opts := Options{Jobs: jobs, KeepGoing: r.KeepGoing, Context: ctx, TargetTimeout: r.TargetTimeout}
+	if r.Output == "json" {
+		opts.Stdout = os.Stderr // keep stdout for the summary
+	}
+	if r.DryRun {
+		// One task at a time keeps the plan in target order.
+		r.plan = &Plan{}
+		opts.Context = WithPlan(ctx, r.plan)
+		opts.Jobs = 1
+		opts.Stdout = io.Discard
+	}
+	return opts
+}
+
+func (r *Report) summary() bool {
+	return r.KeepGoing || r.Output == "json"
+}
+
+// Collect records results. Without --keep-going, a failure ends the command:
+// with log.Fatalf like before, or through Finish when a summary is printed.
+func (r *Report) Collect(results []Result, err error, msg string) {
+	r.results = append(r.results, results...)
+	if err == nil || r.KeepGoing {
+		return
+	}
+	if !r.summary() {
+		log.Fatalf("%s %v", msg, err)
+	}
+	r.Finish()
+}
+
+// Finish prints the summary, if asked for, and exits non-zero when a task failed.
+func (r *Report) Finish() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.DryRun {
+		if err := WritePlan(os.Stdout, r.plan, r.Output); err != nil {
+			log.Fatalf("failed to write plan: %v", err)
+		}
+		return
+	}
+	if r.summary() {
+		if err := WriteSummary(os.Stdout, r.results, r.Output); err != nil {
+			log.Fatalf("failed to write summary: %v", err)
+		}
+	}
+	if Failed(r.results) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,329 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusSkipped  = "skipped"  // not started after an earlier failure
+	StatusCached   = "cached"   // outputs reused from the build cache
+	StatusTimeout  = "timeout"  // stopped by --timeout or --target-timeout
+	StatusCanceled = "canceled" // stopped by SIGINT/SIGTERM
+)
+
+// ErrCached is returned by a Task's Run when it reused a cached result
+// instead of doing the work; the task counts as cached, not failed.
+var ErrCached = errors.New("cached")
+
+// tailLines is how many trailing stderr lines a Result keeps.
+const tailLines = 5
+
+// Task is one operation on one target.
+type Task struct {
+	Target    string        // target name, used to prefix output
+	Operation string        // e.g. clean, mod, build
+	Label     string        // output prefix instead of Target, when set
+	Timeout   time.Duration // overrides Options.TargetTimeout when set
+	Run       func(ctx context.Context, stdout, stderr io.Writer) error
+}
+
+// Options tunes how tasks are run.
+type Options struct {
+	Jobs      int  // maximum number of tasks running at once; <1 means 1
+	KeepGoing bool // start every task even after a failure
+	// Stdout receives task output, os.Stdout when nil. Stderr is always os.Stderr.
+	Stdout io.Writer
+	// Context bounds the whole run, Context() when nil. Once it is done, no
+	// task starts and running ones are stopped.
+	Context context.Context
+	// TargetTimeout bounds each task; 0 means no limit.
+	TargetTimeout time.Duration
+}
+
+// Result is the outcome of a single task.
+type Result struct {
+	Target     string        `json:"target"`
+	Operation  string        `json:"operation"`
+	Status     string        `json:"status"` // ok|failed|skipped|cached|timeout|canceled
+	Duration   time.Duration `json:"-"`
+	DurationMs int64         `json:"duration_ms"`
+	ExitCode   int           `json:"exit_code"` // -1 when the task failed without an exit status
+	Error      string        `json:"error,omitempty"`
+	Stderr     []string      `json:"stderr,omitempty"` // last lines written to stderr
+}
+
+// Run runs tasks on a pool of opts.Jobs workers, in order of submission, and
+// returns one result per task in the same order. With more than one worker,
+// each output line is prefixed with "[target] " so that concurrent targets
+// don't interleave mid-line.
+//
+// Unless opts.KeepGoing is set, no new task is started after the first
+// failure; running tasks finish and the rest are reported as skipped. The
+// same goes, keep-going or not, once opts.Context is done. The returned
+// error is the first failure.
+func Run(tasks []Task, opts Options) ([]Result, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = Context()
+	}
+	active.Add(1)
+	defer active.Add(-1)
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(tasks) {
+		jobs = len(tasks)
+	}
+	var stdoutW io.Writer = os.Stdout
+	if opts.Stdout != nil {
+		stdoutW = opts.Stdout
+	}
+
+	results := make([]Result, len(tasks))
+	for i, t := range tasks {
+		results[i] = Result{Target: t.Target, Operation: t.Operation, Status: StatusSkipped}
+	}
+
+	var (
+		mu       sync.Mutex // guards firstErr and the shared output streams
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	stopped := func() bool {
+		if ctx.Err() != nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil && !opts.KeepGoing
+	}
+
+	queue := make(chan int)
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if stopped() {
+					continue // leave it skipped
+				}
+				timeout := tasks[i].Timeout
+				if timeout == 0 {
+					timeout = opts.TargetTimeout
+				}
+				results[i] = runTask(ctx, tasks[i], timeout, jobs > 1, &mu, stdoutW)
+				if failedStatus(results[i].Status) {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = errors.New(results[i].Error)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range tasks {
+		if stopped() {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, firstErr
+}
+
+func runTask(ctx context.Context, t Task, timeout time.Duration, prefixed bool, mu *sync.Mutex, stdoutW io.Writer) Result {
+	var stdout, stderr io.Writer = stdoutW, os.Stderr
+	var po, pe *prefixWriter
+	if prefixed {
+		label := t.Label
+		if label == "" {
+			label = t.Target
+		}
+		po = newPrefixWriter(mu, stdoutW, label)
+		pe = newPrefixWriter(mu, os.Stderr, label)
+		stdout, stderr = po, pe
+	}
+	tail := &tailWriter{}
+	stderr = io.MultiWriter(stderr, tail)
+
+	taskCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		taskCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	err := t.Run(withScope(taskCtx, t.Target, t.Operation), stdout, stderr)
+	if po != nil {
+		po.Flush()
+		pe.Flush()
+	}
+
+	r := Result{Target: t.Target, Operation: t.Operation, Status: StatusOK, Duration: time.Since(start)}
+	r.DurationMs = r.Duration.Milliseconds()
+	if errors.Is(err, ErrCached) {
+		r.Status = StatusCached
+		err = nil
+	}
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		r.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			r.ExitCode = exitErr.ExitCode()
+		}
+		r.Stderr = tail.Lines()
+
+		switch {
+		case errors.Is(taskCtx.Err(), context.DeadlineExceeded):
+			r.Status = StatusTimeout
+			if ctx.Err() == nil {
+				r.Error = fmt.Sprintf("timed out after %s: %s", timeout, r.Error)
+			} else {
+				r.Error = "timed out: " + r.Error
+			}
+		case taskCtx.Err() != nil:
+			r.Status = StatusCanceled
+			r.Error = "canceled: " + r.Error
+		}
+	}
+	return r
+}
+
+func failedStatus(status string) bool {
+	return status == StatusFailed || status == StatusTimeout || status == StatusCanceled
+}
+
+// Failed reports whether any result failed, timed out or was canceled.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if failedStatus(r.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exec runs name with args in dir, with env added to the current environment,
+// writing to stdout and stderr. It is stopped, with its children, when ctx is
+// done; see Command. In a dry run it only records the command in the plan.
+func Exec(ctx context.Context, stdout, stderr io.Writer, dir string, env []string, name string, args ...string) error {
+	if p := PlanFrom(ctx); p != nil {
+		p.Add(ctx, Step{Dir: dir, Argv: append([]string{name}, args...), Env: env})
+		return nil
+	}
+	cmd := Command(ctx, name, args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// prefixWriter writes complete lines, each prefixed with the target name, to
+// a shared writer. A trailing partial line is held back until Flush.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    bytes.Buffer
+}
+
+func newPrefixWriter(mu *sync.Mutex, w io.Writer, target string) *prefixWriter {
+	return &prefixWriter{mu: mu, w: w, prefix: []byte(fmt.Sprintf("[%s] ", target))}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+
+	var out bytes.Buffer
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		out.Write(p.prefix)
+		out.Write(p.buf.Next(i + 1))
+	}
+	if out.Len() > 0 {
+		p.mu.Lock()
+		_, err := p.w.Write(out.Bytes())
+		p.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes a held back partial line, terminated with a newline.
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(p.prefix)
+	p.w.Write(p.buf.Bytes())
+	p.w.Write([]byte("\n"))
+	p.buf.Reset()
+}
+
+// tailWriter keeps the last tailLines non-empty lines written to it.
+type tailWriter struct {
+	mu      sync.Mutex
+	lines   []string
+	partial string
+}
+
+func (t *tailWriter) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := strings.Split(t.partial+string(b), "\n")
+	t.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t.lines = append(t.lines, line)
+		if len(t.lines) > tailLines {
+			t.lines = t.lines[1:]
+		}
+	}
+	return len(b), nil
+}
+
+// Lines returns the kept lines, including a trailing partial line.
+func (t *tailWriter) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	if strings.TrimSpace(t.partial) != "" {
+		lines = append(lines, t.partial)
+	}
+	if len(lines) > tailLines {
+		lines = lines[len(lines)-tailLines:]
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary is the machine-readable report of a run.
+type Summary struct {
+	Results  []Result `json:"results"`
+	Failed   int      `json:"failed"`
+	Skipped  int      `json:"skipped"`
+	Cached   int      `json:"cached"`
+	Timeout  int      `json:"timeout"`
+	Canceled int      `json:"canceled"`
+	OK       int      `json:"ok"`
+}
+
+// Summarize counts results by status.
+func Summarize(results []Result) Summary {
+	s := Summary{Results: results}
+	if s.Results == nil {
+		s.Results = []Result{}
+	}
+	for _, r := range results {
+		switch r.Status {
+		case StatusOK:
+			s.OK++
+		case StatusFailed:
+			s.Failed++
+		case StatusSkipped:
+			s.Skipped++
+		case StatusCached:
+			s.Cached++
+		case StatusTimeout:
+			s.Timeout++
+		case StatusCanceled:
+			s.Canceled++
+		}
+	}
+	return s
+}
+
+// WriteSummary writes results as a table (text) or as a Summary (json).
+func WriteSummary(w io.Writer, results []Result, output string) error {
+	switch output {
+	case "json":
+		return json.NewEncoder(w).Encode(Summarize(results))
+	case "text":
+		s := Summarize(results)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TARGET\tOPERATION\tSTATUS\tDURATION\tEXIT")
+		for _, r := range results {
+			exit := "-"
+			if r.Status != StatusSkipped {
+				exit = fmt.Sprint(r.ExitCode)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Target, r.Operation, r.Status, r.Duration.Round(time.Millisecond), exit)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		for _, r := range results {
+			if !failedStatus(r.Status) {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s (%s): %s\n", r.Target, r.Operation, r.Error)
+			for _, line := range r.Stderr {
+				fmt.Fprintf(w, "    %s\n", strings.TrimRight(line, "\r"))
+			}
+		}
+		fmt.Fprintf(w, "\n%d ok, %d cached, %d failed, %d skipped", s.OK, s.Cached, s.Failed, s.Skipped)
+		if s.Timeout > 0 {
+			fmt.Fprintf(w, ", %d timed out", s.Timeout)
+		}
+		if s.Canceled > 0 {
+			fmt.Fprintf(w, ", %d canceled", s.Canceled)
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+	return fmt.Errorf("invalid output: %q (expected: text|json)", output)
+}
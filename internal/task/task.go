@@ -0,0 +1,264 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// Task is a named command from the `tasks:` section of flow.yaml, run in the
+// dir of every target it applies to.
+type Task struct {
+	Name      string
+	Command   string            // run with sh -c
+	Kinds     []string          // kinds it applies to; all when empty
+	Selector  string            // label selector the targets must match
+	Env       map[string]string // added to the environment of the command
+	DependsOn []string          // tasks that must run first
+
+	selector utils.Selector
+}
+
+// taskConfig mirrors a single entry of the `tasks:` section in flow.yaml.
+type taskConfig struct {
+	Command   string            `mapstructure:"command"`
+	Kinds     []string          `mapstructure:"kinds"`
+	Selector  string            `mapstructure:"selector"`
+	Env       map[string]string `mapstructure:"env"`
+	DependsOn []string          `mapstructure:"depends_on"`
+}
+
+// ResolveTasks reads and validates the `tasks:` config against kinds.
+func ResolveTasks(kinds []common.Kind) (map[string]*Task, error) {
+	var configured map[string]taskConfig
+	if err := viper.UnmarshalKey("tasks", &configured); err != nil {
+		return nil, fmt.Errorf("failed to parse tasks config: %w", err)
+	}
+
+	known := make(map[string]struct{}, len(kinds))
+	for _, k := range kinds {
+		known[k.Name] = struct{}{}
+	}
+
+	tasks := make(map[string]*Task, len(configured))
+	for name, tc := range configured {
+		if strings.TrimSpace(tc.Command) == "" {
+			return nil, fmt.Errorf("task %q has no command", name)
+		}
+		for _, k := range tc.Kinds {
+			if _, ok := known[k]; !ok {
+				return nil, fmt.Errorf("task %q applies to unknown kind %q", name, k)
+			}
+		}
+		sel, err := utils.ParseSelector(tc.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("task %q: %w", name, err)
+		}
+
+		// viper lower-cases map keys; environment variables are upper case.
+		env := make(map[string]string, len(tc.Env))
+		for k, v := range tc.Env {
+			env[strings.ToUpper(k)] = v
+		}
+
+		tasks[name] = &Task{
+			Name:      name,
+			Command:   tc.Command,
+			Kinds:     tc.Kinds,
+			Selector:  tc.Selector,
+			Env:       env,
+			DependsOn: tc.DependsOn,
+			selector:  sel,
+		}
+	}
+
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := tasks[dep]; !ok {
+				return nil, fmt.Errorf("task %q depends on unknown task %q", t.Name, dep)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// AppliesTo reports whether the task runs in target t.
+func (t *Task) AppliesTo(target common.Target) bool {
+	if len(t.Kinds) > 0 {
+		found := false
+		for _, k := range t.Kinds {
+			if k == target.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return t.selector.Matches(target.Labels)
+}
+
+// Plan returns name and its transitive dependencies in layers: every task
+// only depends on tasks of earlier layers. Tasks within a layer are sorted.
+func Plan(tasks map[string]*Task, name string) ([][]*Task, error) {
+	if _, ok := tasks[name]; !ok {
+		return nil, fmt.Errorf("unknown task %q", name)
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	depth := make(map[string]int) // longest dependency chain below a task
+
+	var visit func(n string, path []string) error
+	visit = func(n string, path []string) error {
+		switch state[n] {
+		case visiting:
+			return fmt.Errorf("task dependency cycle: %s", strings.Join(append(path, n), " -> "))
+		case done:
+			return nil
+		}
+		state[n] = visiting
+		d := 0
+		for _, dep := range tasks[n].DependsOn {
+			if err := visit(dep, append(path, n)); err != nil {
+				return err
+			}
+			if depth[dep]+1 > d {
+				d = depth[dep] + 1
+			}
+		}
+		depth[n] = d
+		state[n] = done
+		return nil
+	}
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+
+	layers := make([][]*Task, depth[name]+1)
+	for n := range depth {
+		layers[depth[n]] = append(layers[depth[n]], tasks[n])
+	}
+	for _, l := range layers {
+		sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	}
+	return layers, nil
+}
+
+// Run runs the layers of a plan over targets, one layer after the other, each
+// layer on the runner pool. A task is skipped for a target when one of its
+// dependencies failed there, or failed anywhere if it doesn't apply there.
+// Without opts.KeepGoing, the first failing layer is the last one to run.
+func Run(layers [][]*Task, targets []common.Target, opts runner.Options) ([]runner.Result, error) {
+	failedOn := make(map[string]map[string]bool) // task → target ID → failed
+	var all []runner.Result
+	var firstErr error
+
+	for _, layer := range layers {
+		var tasks []runner.Task
+		for _, t := range layer {
+			failedOn[t.Name] = make(map[string]bool)
+			for _, target := range targets {
+				if !t.AppliesTo(target) {
+					continue
+				}
+				if firstErr != nil && !opts.KeepGoing {
+					all = append(all, skipped(t, target, "an earlier task failed"))
+					continue
+				}
+				if dep := blockedBy(t, target, layerTasks(layers), failedOn); dep != "" {
+					failedOn[t.Name][target.ID()] = true
+					all = append(all, skipped(t, target, fmt.Sprintf("dependency %s failed", dep)))
+					continue
+				}
+				tasks = append(tasks, command(t, target))
+			}
+		}
+		if len(tasks) == 0 {
+			continue
+		}
+
+		results, err := runner.Run(tasks, opts)
+		for _, r := range results {
+			if r.Status != runner.StatusOK {
+				failedOn[r.Operation][r.Target] = true
+			}
+		}
+		all = append(all, results...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return all, firstErr
+}
+
+func command(t *Task, target common.Target) runner.Task {
+	env := []string{
+		"FLOW_TASK=" + t.Name,
+		"FLOW_KIND=" + target.Kind,
+		"FLOW_TARGET=" + target.Name,
+		"FLOW_TARGET_DIR=" + target.Dir,
+	}
+	keys := make([]string, 0, len(t.Env))
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+t.Env[k])
+	}
+
+	return runner.Task{
+		Target:    target.ID(),
+		Operation: t.Name,
+		Label:     t.Name + " " + target.ID(),
+		Timeout:   target.Timeout(),
+		Run: func(ctx context.Context, stdout, stderr io.Writer) error {
+			if err := runner.Exec(ctx, stdout, stderr, target.Dir, env, "sh", "-c", t.Command); err != nil {
+				return fmt.Errorf("task %s failed in %s: %w", t.Name, target.Dir, err)
+			}
+			return nil
+		},
+	}
+}
+
+func skipped(t *Task, target common.Target, reason string) runner.Result {
+	return runner.Result{Target: target.ID(), Operation: t.Name, Status: runner.StatusSkipped, Error: reason}
+}
+
+func layerTasks(layers [][]*Task) map[string]*Task {
+	byName := make(map[string]*Task)
+	for _, l := range layers {
+		for _, t := range l {
+			byName[t.Name] = t
+		}
+	}
+	return byName
+}
+
+// blockedBy returns the dependency of t whose failure blocks it on target.
+func blockedBy(t *Task, target common.Target, tasks map[string]*Task, failedOn map[string]map[string]bool) string {
+	for _, name := range t.DependsOn {
+		dep := tasks[name]
+		if dep.AppliesTo(target) {
+			if failedOn[name][target.ID()] {
+				return name
+			}
+		} else if len(failedOn[name]) > 0 {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TargetDiscovery controls how target dirs are found below a kind root.
+type TargetDiscovery struct {
+	// Markers are file names (e.g. go.mod, Dockerfile) that make a dir a
+	// target, at any depth up to Depth. Without markers, targets are the
+	// dirs exactly Depth levels below the root.
+	Markers []string
+	// Depth is the maximum number of levels below the root to search. Zero
+	// means 1 without markers and unlimited with markers.
+	Depth int
+}
+
+// Nested reports whether targets can live deeper than one level.
+func (d TargetDiscovery) Nested() bool {
+	return len(d.Markers) > 0 || d.Depth > 1
+}
+
+// MaxDepth returns the search depth, or -1 when it is unlimited.
+func (d TargetDiscovery) MaxDepth() int {
+	switch {
+	case d.Depth > 0:
+		return d.Depth
+	case len(d.Markers) > 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// IsMarker reports whether a file name is one of the markers.
+func (d TargetDiscovery) IsMarker(name string) bool {
+	for _, m := range d.Markers {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d TargetDiscovery) hasMarker(dir string) bool {
+	for _, m := range d.Markers {
+		if _, err := os.Stat(filepath.Join(dir, m)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscoverTargetDirs walks absPath and returns the sorted absolute paths of
+// its targets. Targets don't nest: the walk stops descending at the first
+// target on each branch. Hidden, vendor, node_modules and testdata dirs are
+// skipped.
+func DiscoverTargetDirs(absPath string, d TargetDiscovery) ([]string, error) {
+	if !d.Nested() {
+		// Legacy layout: every direct subdirectory is a target.
+		entries, err := os.ReadDir(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read targets dir: %w", err)
+		}
+		var resolved []string
+		for _, entry := range entries {
+			if entry.IsDir() {
+				resolved = append(resolved, filepath.Join(absPath, entry.Name()))
+			}
+		}
+		return resolved, nil
+	}
+
+	if _, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("failed to read targets dir: %w", err)
+	}
+
+	maxDepth := d.MaxDepth()
+	var resolved []string
+	err := filepath.WalkDir(absPath, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !e.IsDir() || p == absPath {
+			return nil
+		}
+		if SkipDiscoveryDir(e.Name()) {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(absPath, p)
+		if err != nil {
+			return err
+		}
+		depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+
+		if (len(d.Markers) == 0 && depth == maxDepth) || (len(d.Markers) > 0 && d.hasMarker(p)) {
+			resolved = append(resolved, p)
+			return filepath.SkipDir
+		}
+		if maxDepth > 0 && depth >= maxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+// TargetDirsFromFiles returns the sorted target dirs, relative to root, that
+// marker files among the slash-separated, root-relative files point to. It
+// finds targets that only exist in another tree than the working one.
+func TargetDirsFromFiles(files []string, d TargetDiscovery) []string {
+	maxDepth := d.MaxDepth()
+	seen := make(map[string]struct{})
+	for _, f := range files {
+		if !d.IsMarker(path.Base(f)) {
+			continue
+		}
+		dir := path.Dir(f)
+		if dir == "." {
+			continue
+		}
+		segs := strings.Split(dir, "/")
+		if maxDepth > 0 && len(segs) > maxDepth {
+			continue
+		}
+		skip := false
+		for _, s := range segs {
+			if SkipDiscoveryDir(s) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			seen[dir] = struct{}{}
+		}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return OutermostDirs(dirs)
+}
+
+// OutermostDirs drops the sorted, slash-separated dirs that lie inside another
+// dir of the list.
+func OutermostDirs(sorted []string) []string {
+	all := make(map[string]struct{}, len(sorted))
+	for _, dir := range sorted {
+		all[dir] = struct{}{}
+	}
+
+	var kept []string
+	for _, dir := range sorted {
+		nested := false
+		for parent := path.Dir(dir); parent != "." && parent != "/"; parent = path.Dir(parent) {
+			if _, ok := all[parent]; ok {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, dir)
+		}
+	}
+	return kept
+}
+
+// SkipDiscoveryDir reports whether a dir name is never searched for targets.
+func SkipDiscoveryDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata"
+}
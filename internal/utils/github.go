@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WriteGitHubOutput appends key=value pairs to the GitHub Actions step
+// outputs file named by $GITHUB_OUTPUT. Multi-line values use the heredoc
+// delimiter syntax.
+func WriteGitHubOutput(pairs ...[2]string) error {
+	p := os.Getenv("GITHUB_OUTPUT")
+	if p == "" {
+		return fmt.Errorf("GITHUB_OUTPUT is not set (not running in GitHub Actions?)")
+	}
+
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT: %w", err)
+	}
+	defer f.Close()
+
+	for _, kv := range pairs {
+		var line string
+		if strings.Contains(kv[1], "\n") {
+			line = fmt.Sprintf("%s<<FLOW_EOF\n%s\nFLOW_EOF\n", kv[0], kv[1])
+		} else {
+			line = fmt.Sprintf("%s=%s\n", kv[0], kv[1])
+		}
+		if _, err := f.WriteString(line); err != nil {
+			return fmt.Errorf("failed to write GITHUB_OUTPUT: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// MatchPath reports whether the slash-separated, repo-relative path p matches
+// a gitignore-style glob pattern:
+//   - `*`, `?` and `[...]` match within a single path segment,
+//   - `**` matches any number of segments,
+//   - a pattern without `/` matches a file or directory name at any depth,
+//   - a leading `/` anchors the pattern to the repo root,
+//   - a trailing `/` only matches directories.
+//
+// A pattern that matches a directory also matches everything beneath it.
+func MatchPath(pattern, p string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	patSegs := strings.Split(pattern, "/")
+	segs := strings.Split(path.Clean(p), "/")
+
+	for i := len(segs); i >= 1; i-- {
+		if dirOnly && i == len(segs) {
+			continue // the full path names a file
+		}
+		if anchored {
+			if matchSegments(patSegs, segs[:i]) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, segs[i-1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAnyPath returns the first pattern that matches p, if any.
+func MatchAnyPath(patterns []string, p string) (string, bool) {
+	for _, pattern := range patterns {
+		if MatchPath(pattern, p) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return len(segs) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pat[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pat[0], segs[0]); !ok {
+		return false
+	}
+	return matchSegments(pat[1:], segs[1:])
+}
+
+// MatchIgnore reports whether p is ignored by .gitignore-style patterns. The
+// last matching pattern wins, and a leading `!` re-includes a path.
+func MatchIgnore(patterns []string, p string) bool {
+	ignored := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if MatchPath(strings.TrimPrefix(pattern, "!"), p) {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+// ReadPatternFile reads one pattern per line, skipping blanks and `#` comments.
+// A missing file yields no patterns.
+func ReadPatternFile(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
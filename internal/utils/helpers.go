@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -46,39 +47,54 @@ func ResolveStringValue(flagVal, configKey string, envVars ...string) string {
 	return ""
 }
 
-func FormAbsolutePathToDir(projectRoot, srcDir, subdir string) string {
-	return filepath.Join(projectRoot, srcDir, subdir)
+// FormAbsolutePathToDiscoveredTargetDirs returns absolute paths to the targets
+// below absPath found by d. Named targets are paths relative to absPath (e.g.
+// payments/ledger-api) or, when unambiguous, a discovered target's base name.
+// A path only names a target when d discovers it or it holds a marker, so a
+// grouping dir like payments is never built as one. A name that matches no
+// target yields an error wrapping fs.ErrNotExist.
+func FormAbsolutePathToDiscoveredTargetDirs(absPath string, targets []string, d TargetDiscovery) ([]string, error) {
+	discovered, err := DiscoverTargetDirs(absPath, d)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return discovered, nil
+	}
 
-}
+	known := make(map[string]struct{}, len(discovered))
+	for _, dir := range discovered {
+		known[dir] = struct{}{}
+	}
 
-// returns absolute path to targets
-func FormAbsolutePathToTargetDirs(absPath string, targets []string) ([]string, error) {
 	var resolved []string
-
-	if len(targets) > 0 {
-		// Specific targets passed via --target
-		for _, t := range targets {
-			full := filepath.Join(absPath, t)
-			if _, err := os.Stat(full); os.IsNotExist(err) {
-				return nil, fmt.Errorf("target %s does not exist at path %s", t, full)
-			}
+	for _, t := range targets {
+		full := filepath.Join(absPath, t)
+		if _, ok := known[full]; ok || (len(d.Markers) > 0 && d.hasMarker(full)) {
 			resolved = append(resolved, full)
+			continue
 		}
-	} else {
-		// No targets passed: resolve all directories in servicesDir
-		entries, err := os.ReadDir(absPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read services dir: %w", err)
-		}
-		for _, entry := range entries {
-			if entry.IsDir() {
-				resolved = append(resolved, filepath.Join(absPath, entry.Name()))
+
+		// Fall back to matching the base name of a nested target.
+		var matches []string
+		for _, dir := range discovered {
+			if filepath.Base(dir) == t {
+				matches = append(matches, dir)
 			}
 		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("target %s does not exist at path %s: %w", t, full, fs.ErrNotExist)
+		case 1:
+			resolved = append(resolved, matches[0])
+		default:
+			return nil, fmt.Errorf("target %s is ambiguous under %s, use its relative path", t, absPath)
+		}
 	}
 
 	return resolved, nil
 }
+
 func HasBin(command string) bool {
 	_, err := exec.LookPath(command)
 	return err == nil
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DetectLanguage guesses the language of the target at dir from its marker
+// files: go, python, node, docker, or "" when nothing is recognized.
+func DetectLanguage(dir string) string {
+	has := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	switch {
+	case has("go.mod"):
+		return "go"
+	case has("pyproject.toml"), has("requirements.txt"), has("setup.py"):
+		return "python"
+	case has("package.json"):
+		return "node"
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		switch {
+		case strings.HasSuffix(e.Name(), ".go"):
+			return "go"
+		case strings.HasSuffix(e.Name(), ".py"):
+			return "python"
+		}
+	}
+	if has("Dockerfile") {
+		return "docker"
+	}
+	return ""
+}
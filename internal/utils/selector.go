@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Selector is a parsed Kubernetes-style label selector. The zero value
+// matches everything.
+type Selector struct {
+	requirements []requirement
+}
+
+type requirement struct {
+	key    string
+	op     string // =, !=, in, notin, exists, !exists
+	values []string
+}
+
+var labelKeyRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// ParseSelector parses comma-separated requirements:
+//   - key=value, key==value, key!=value
+//   - key in (a,b), key notin (a,b)
+//   - key (label set), !key (label not set)
+//
+// An empty string yields a selector that matches every target.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitSelector(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %w", part, err)
+		}
+		sel.requirements = append(sel.requirements, r)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector has no requirements.
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		v, ok := labels[r.key]
+		switch r.op {
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		case "=", "in":
+			if !ok || !contains(r.values, v) {
+				return false
+			}
+		case "!=", "notin":
+			// Like Kubernetes, a missing label satisfies a negative requirement.
+			if ok && contains(r.values, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitSelector splits on commas outside of parentheses.
+func splitSelector(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseRequirement(part string) (requirement, error) {
+	if strings.HasPrefix(part, "!") {
+		key := strings.TrimSpace(part[1:])
+		if !labelKeyRe.MatchString(key) {
+			return requirement{}, fmt.Errorf("bad label key %q", key)
+		}
+		return requirement{key: key, op: "!exists"}, nil
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(part, op); i >= 0 {
+			key := strings.TrimSpace(part[:i])
+			value := strings.TrimSpace(part[i+len(op):])
+			if !labelKeyRe.MatchString(key) {
+				return requirement{}, fmt.Errorf("bad label key %q", key)
+			}
+			if op == "==" {
+				op = "="
+			}
+			return requirement{key: key, op: op, values: []string{value}}, nil
+		}
+	}
+
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		if !labelKeyRe.MatchString(fields[0]) {
+			return requirement{}, fmt.Errorf("bad label key %q", fields[0])
+		}
+		return requirement{key: fields[0], op: "exists"}, nil
+	}
+	if len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin") {
+		key, op := fields[0], fields[1]
+		set := strings.TrimSpace(strings.TrimPrefix(part, key))
+		set = strings.TrimSpace(strings.TrimPrefix(set, op))
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return requirement{}, fmt.Errorf("expected a (value,...) set after %s", op)
+		}
+		var values []string
+		for _, v := range strings.Split(set[1:len(set)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return requirement{}, fmt.Errorf("empty value set")
+		}
+		if !labelKeyRe.MatchString(key) {
+			return requirement{}, fmt.Errorf("bad label key %q", key)
+		}
+		return requirement{key: key, op: op, values: values}, nil
+	}
+	return requirement{}, fmt.Errorf("expected key=value, key!=value, key in (...), key notin (...), key or !key")
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
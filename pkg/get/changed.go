@@ -2,32 +2,112 @@ package get
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/selimacerbas/flow/internal/common"
 	"github.com/selimacerbas/flow/internal/utils"
 )
 
+const (
+	ReasonDirect     = "direct"     // a file under the target folder changed
+	ReasonDependency = "dependency" // a transitive in-repo dependency changed
+	ReasonGlobal     = "global"     // a file matching an invalidation pattern changed
+	ReasonWatch      = "watch"      // a file matching a watch glob of the target manifest changed
+)
+
+const (
+	StatusAdded    = "added"
+	StatusModified = "modified"
+	StatusDeleted  = "deleted"
+	StatusRenamed  = "renamed"
+)
+
+// ChangedTarget describes why a single target is reported as changed.
+type ChangedTarget struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`   // repo-relative target dir
+	Status     string `json:"status"` // added|modified|deleted|renamed
+	OldName    string `json:"old_name,omitempty"`
+	Reason     string `json:"reason"`
+	Dependency string `json:"dependency,omitempty"` // changed in-repo path or target behind a dependency reason
+	Pattern    string `json:"pattern,omitempty"`    // pattern behind a global or watch reason
+}
+
+// Explanation lists the rule and the changed files that made a target changed.
+type Explanation struct {
+	Rule    string   `json:"rule"`              // direct|dependency|global|watch
+	Pattern string   `json:"pattern,omitempty"` // pattern of a global or watch rule
+	Files   []string `json:"files"`
+}
+
+// ChangedOptions tunes how GetChanged decides that a target changed.
+type ChangedOptions struct {
+	NoIgnore  bool   // don't apply `ignore` config and .flowignore patterns
+	Staged    bool   // compare ref1 with the index instead of ref2
+	Worktree  bool   // compare ref1 with the working tree instead of ref2
+	Untracked bool   // also count untracked, non-ignored files as added
+	Selector  string // only report targets whose labels match this selector
+}
+
 type ChangedOutput struct {
-	Functions []string
-	Services  []string
+	Kinds   map[string][]string       // changed target names keyed by kind name
+	Targets map[string]*ChangedTarget // keyed by "<kind>/<name>"
+	Explain map[string]*Explanation   // keyed by "<kind>/<name>"
+}
+
+// changeSet is the diff between two refs that targets are matched against.
+type changeSet struct {
+	root         string
+	ref1         string
+	existsAfter  func(relPath string) bool // presence on the ref2/index/worktree side
+	changes      []FileChange
+	files        []string // changed paths left after repo-wide ignores
+	globals      []string // global invalidation patterns
+	targetIgnore bool     // apply each target's own .flowignore
+	resolver     *GoDepResolver
+	dependents   []dependent // unchanged targets whose manifest lists depends_on
 }
 
-// GetChanged finds the changed functions and services between two git references.
-func GetChanged(ref1, ref2, scope, srcDir, funcSub, svcSub string) (*ChangedOutput, error) {
+// dependent is an unchanged target that changes when one of its manifest
+// depends_on targets does.
+type dependent struct {
+	kind, name, path string
+	dependsOn        []string // "<kind>/<name>"
+}
+
+// GetChanged finds the changed targets of every kind selected by scope between
+// two git references. Go targets are also reported when a transitive in-repo
+// dependency (imported package, local replace or go.work module) changed, and
+// every target of a kind is reported when a changed file matches one of the
+// global or per-kind invalidation patterns. A target's flow.target.yaml can add
+// watch globs and depends_on targets that also mark it as changed.
+//
+// With opts.Staged or opts.Worktree, ref2 is ignored and ref1 is compared with
+// the index or the working tree; opts.Untracked adds untracked files on top
+// (and implies the working tree when neither is set).
+//
+// Unless opts.NoIgnore is set, files matching the `ignore` config, the repo
+// root .flowignore or a target's own .flowignore are dropped before deciding.
+func GetChanged(ref1, ref2, scope, srcDir, funcSub, svcSub string, opts ChangedOptions) (*ChangedOutput, error) {
 	// repo root
 	root, err := utils.DetectProjectRoot()
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect project root: %w", err)
 	}
 
-	// normalize dirs
-	srcDir = common.ResolveSrcDir(srcDir)
-	funcSub = common.ResolveFunctionsDir(funcSub)
-	svcSub = common.ResolveServicesDir(svcSub)
-
-	funcRelPath := filepath.Join(srcDir, funcSub)
-	svcRelPath := filepath.Join(srcDir, svcSub)
+	kinds, err := common.ResolveScopeKinds(scope, srcDir, funcSub, svcSub)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := utils.ParseSelector(opts.Selector)
+	if err != nil {
+		return nil, err
+	}
 
 	ref1SHA, err := GetCommitSHA(root, ref1)
 	if err != nil {
@@ -37,43 +117,381 @@ func GetChanged(ref1, ref2, scope, srcDir, funcSub, svcSub string) (*ChangedOutp
 		ref1SHA = common.EmptyTree
 	}
 
-	ref2SHA, err := GetCommitSHA(root, ref2)
+	if opts.Staged && opts.Worktree {
+		return nil, fmt.Errorf("--staged and --worktree are mutually exclusive")
+	}
+	local := opts.Staged || opts.Worktree || opts.Untracked
+
+	onDisk := func(p string) bool {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		return err == nil
+	}
+
+	var changes []FileChange
+	var existsAfter func(string) bool
+	switch {
+	case opts.Staged:
+		changes, err = GetLocalFileChanges(root, ref1SHA, true)
+		existsAfter = func(p string) bool {
+			// Untracked targets only exist on disk.
+			return PathExistsInIndex(root, p) || (opts.Untracked && onDisk(p))
+		}
+	case local:
+		changes, err = GetLocalFileChanges(root, ref1SHA, false)
+		existsAfter = onDisk
+	default:
+		var ref2SHA string
+		ref2SHA, err = GetCommitSHA(root, ref2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit SHA for %s: %w", ref2, err)
+		}
+		if ref2SHA == common.ZeroCommit {
+			ref2SHA = common.EmptyTree
+		}
+		changes, err = GetFileChanges(root, ref1SHA, ref2SHA)
+		existsAfter = func(p string) bool { return PathExistsAtRef(root, ref2SHA, p) }
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get commit SHA for %s: %w", ref2, err)
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
 	}
-	if ref2SHA == common.ZeroCommit {
-		ref2SHA = common.EmptyTree
+
+	if opts.Untracked {
+		untracked, err := GetUntrackedFiles(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files: %w", err)
+		}
+		for _, f := range untracked {
+			changes = append(changes, FileChange{Status: "A", Path: f})
+		}
+	}
+
+	cs := &changeSet{
+		root:         root,
+		ref1:         ref1SHA,
+		existsAfter:  existsAfter,
+		changes:      changes,
+		files:        ChangedPaths(changes),
+		globals:      common.ResolveInvalidatePatterns(),
+		targetIgnore: !opts.NoIgnore,
 	}
 
-	var funcs, svcs []string
-	switch scope {
-	case "function":
-		funcs, err = GetChangedDirs(root, funcRelPath, ref1SHA, ref2SHA)
+	if !opts.NoIgnore {
+		patterns, err := utils.ReadPatternFile(filepath.Join(root, common.IgnoreFile))
 		if err != nil {
-			return nil, fmt.Errorf("failed to detect chaged function dirs: %w", err)
+			return nil, fmt.Errorf("failed to read %s: %w", common.IgnoreFile, err)
 		}
+		patterns = append(common.ResolveIgnorePatterns(), patterns...)
+		cs.files = filterIgnored(cs.files, patterns)
+	}
 
-	case "service":
-		svcs, err = GetChangedDirs(root, svcRelPath, ref1SHA, ref2SHA)
+	cs.resolver, err = NewGoDepResolver(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan go modules: %w", err)
+	}
+
+	output := &ChangedOutput{
+		Kinds:   make(map[string][]string, len(kinds)),
+		Targets: make(map[string]*ChangedTarget),
+		Explain: make(map[string]*Explanation),
+	}
+	for _, k := range kinds {
+		targets, explain, err := cs.changedTargets(k)
 		if err != nil {
-			return nil, fmt.Errorf("failed detect changed service dirs: %w", err)
+			return nil, fmt.Errorf("failed to detect changed %s dirs: %w", k.Name, err)
+		}
+
+		names := []string{}
+		for _, t := range targets {
+			names = append(names, t.Name)
+			output.Targets[t.Kind+"/"+t.Name] = t
+			output.Explain[t.Kind+"/"+t.Name] = explain[t.Name]
+		}
+		output.Kinds[k.Name] = names
+	}
+	cs.propagateDependsOn(output)
+
+	if !selector.Empty() {
+		if err := filterBySelector(root, kinds, output, selector); err != nil {
+			return nil, err
 		}
-	case "all":
-		// meaning both dir changes
-		funcs, err = GetChangedDirs(root, funcRelPath, ref1SHA, ref2SHA)
+	}
+	return output, nil
+}
+
+// filterBySelector drops the changed targets whose labels don't match.
+func filterBySelector(root string, kinds []common.Kind, output *ChangedOutput, selector utils.Selector) error {
+	for _, k := range kinds {
+		kept := []string{}
+		for _, name := range output.Kinds[k.Name] {
+			t, err := common.LoadTarget(root, k, name)
+			if err != nil {
+				return err
+			}
+			if selector.Matches(t.Labels) {
+				kept = append(kept, name)
+				continue
+			}
+			delete(output.Targets, k.Name+"/"+name)
+			delete(output.Explain, k.Name+"/"+name)
+		}
+		output.Kinds[k.Name] = kept
+	}
+	return nil
+}
+
+// ParseRefRange parses a --changed-between value: a single "A..B" or two refs
+// given as "A,B" or by repeating the flag.
+func ParseRefRange(values []string) (string, string, error) {
+	if len(values) == 1 {
+		if a, b, ok := strings.Cut(values[0], ".."); ok && a != "" && b != "" {
+			return a, b, nil
+		}
+	}
+	if len(values) != 2 || values[0] == "" || values[1] == "" {
+		return "", "", fmt.Errorf("expected two refs (A,B or A..B), got %q", strings.Join(values, ","))
+	}
+	return values[0], values[1], nil
+}
+
+// FilterChanged keeps the targets that changed between ref1 and ref2.
+func FilterChanged(targets []common.Target, ref1, ref2, scope, srcDir, funcSub, svcSub string) ([]common.Target, error) {
+	changed, err := GetChanged(ref1, ref2, scope, srcDir, funcSub, svcSub, ChangedOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []common.Target
+	for _, t := range targets {
+		if _, ok := changed.Targets[t.Kind+"/"+t.Name]; ok {
+			kept = append(kept, t)
+		}
+	}
+	return kept, nil
+}
+
+// propagateDependsOn reports the targets whose manifest depends_on lists a
+// changed target, until no more targets are added.
+func (cs *changeSet) propagateDependsOn(output *ChangedOutput) {
+	for added := true; added; {
+		added = false
+		for _, d := range cs.dependents {
+			key := d.kind + "/" + d.name
+			if _, ok := output.Targets[key]; ok {
+				continue
+			}
+			for _, dep := range d.dependsOn {
+				if _, ok := output.Targets[dep]; !ok {
+					continue
+				}
+				output.Targets[key] = &ChangedTarget{Kind: d.kind, Name: d.name, Path: d.path, Status: StatusModified, Reason: ReasonDependency, Dependency: dep}
+				output.Explain[key] = &Explanation{Rule: ReasonDependency, Files: output.Explain[dep].Files}
+				if _, ok := output.Kinds[d.kind]; ok {
+					output.Kinds[d.kind] = append(output.Kinds[d.kind], d.name)
+					sort.Strings(output.Kinds[d.kind])
+				}
+				added = true
+				break
+			}
+		}
+	}
+}
+
+// changedTargets returns the targets of kind affected by the change set,
+// either directly, through an invalidation pattern or through their in-repo
+// Go dependencies, sorted by name, along with an explanation per target name.
+func (cs *changeSet) changedTargets(kind common.Kind) ([]*ChangedTarget, map[string]*Explanation, error) {
+	relPath := filepath.ToSlash(kind.Path)
+	ix, err := newTargetIndex(cs.root, cs.ref1, kind, cs.files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover %s targets: %w", kind.Name, err)
+	}
+
+	found := make(map[string]*ChangedTarget)
+	explain := make(map[string]*Explanation)
+	for _, name := range ix.targetsOf(cs.files) {
+		targetPath := path.Join(relPath, name)
+		files, err := cs.targetFiles(targetPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to detect chaged function dirs: %w", err)
+			return nil, nil, err
 		}
-		svcs, err = GetChangedDirs(root, svcRelPath, ref1SHA, ref2SHA)
+		if len(files) == 0 {
+			continue
+		}
+		found[name] = &ChangedTarget{Kind: kind.Name, Name: name, Path: targetPath, Reason: ReasonDirect}
+		explain[name] = &Explanation{Rule: ReasonDirect, Files: files}
+	}
+	cs.classify(ix, found, explain)
+
+	// The first changed file matching a global or kind pattern invalidates every target.
+	pattern := ""
+	var invalidating []string
+	for _, f := range cs.files {
+		p, ok := utils.MatchAnyPath(cs.globals, f)
+		if !ok {
+			p, ok = utils.MatchAnyPath(kind.Invalidate, f)
+		}
+		if !ok {
+			continue
+		}
+		if pattern == "" {
+			pattern = p
+		}
+		invalidating = append(invalidating, f)
+	}
+
+	// Targets that still exist on disk may be affected through a pattern or their deps.
+	for _, name := range ix.onDisk {
+		if _, ok := found[name]; ok {
+			continue
+		}
+		targetPath := path.Join(relPath, name)
+
+		if pattern != "" {
+			found[name] = &ChangedTarget{Kind: kind.Name, Name: name, Path: targetPath, Status: StatusModified, Reason: ReasonGlobal, Pattern: pattern}
+			explain[name] = &Explanation{Rule: ReasonGlobal, Pattern: pattern, Files: invalidating}
+			continue
+		}
+
+		t, err := common.LoadTarget(cs.root, kind, name)
 		if err != nil {
-			return nil, fmt.Errorf("failed detect changed service dirs: %w", err)
+			return nil, nil, err
 		}
-	default:
-		return nil, fmt.Errorf("invalid scope: %q (expected: function|service|all)", scope)
+		if m := t.Manifest; m != nil {
+			var watched []string
+			watch := ""
+			for _, f := range cs.files {
+				if p, ok := utils.MatchAnyPath(m.Watch, f); ok {
+					if watch == "" {
+						watch = p
+					}
+					watched = append(watched, f)
+				}
+			}
+			if len(watched) > 0 {
+				found[name] = &ChangedTarget{Kind: kind.Name, Name: name, Path: targetPath, Status: StatusModified, Reason: ReasonWatch, Pattern: watch}
+				explain[name] = &Explanation{Rule: ReasonWatch, Pattern: watch, Files: watched}
+				continue
+			}
+			if len(m.DependsOn) > 0 {
+				cs.dependents = append(cs.dependents, dependent{kind: kind.Name, name: name, path: targetPath, dependsOn: m.DependsOn})
+			}
+		}
+
+		deps, err := cs.resolver.Resolve(targetPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve go deps of %s: %w", name, err)
+		}
+		if deps == nil {
+			continue
+		}
+		var depFiles []string
+		for _, f := range cs.files {
+			_, inDir := deps.Dirs[path.Dir(f)]
+			_, isFile := deps.Files[f]
+			if inDir || isFile {
+				depFiles = append(depFiles, f)
+			}
+		}
+		if len(depFiles) > 0 {
+			found[name] = &ChangedTarget{Kind: kind.Name, Name: name, Path: targetPath, Status: StatusModified, Reason: ReasonDependency, Dependency: depFiles[0]}
+			explain[name] = &Explanation{Rule: ReasonDependency, Files: depFiles}
+		}
+	}
+
+	targets := make([]*ChangedTarget, 0, len(found))
+	for _, t := range found {
+		targets = append(targets, t)
 	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets, explain, nil
+}
 
-	return &ChangedOutput{
-		Functions: funcs,
-		Services:  svcs,
-	}, nil
+// classify sets the status of directly changed targets from their presence on
+// both sides of the diff. A target that appeared while files were renamed out
+// of a target that disappeared is reported once, as renamed from the old name.
+func (cs *changeSet) classify(ix *targetIndex, found map[string]*ChangedTarget, explain map[string]*Explanation) {
+	// new target name → old target name, from file renames across target dirs
+	moved := make(map[string]string)
+	for _, c := range cs.changes {
+		if c.Status != "R" {
+			continue
+		}
+		oldTop, okOld := ix.targetOf(c.OldPath)
+		newTop, okNew := ix.targetOf(c.Path)
+		if okOld && okNew && oldTop != newTop {
+			if _, ok := moved[newTop]; !ok {
+				moved[newTop] = oldTop
+			}
+		}
+	}
+
+	for name, t := range found {
+		before := PathExistsAtRef(cs.root, cs.ref1, t.Path)
+		after := cs.existsAfter(t.Path)
+		switch {
+		case before && after:
+			t.Status = StatusModified
+		case after:
+			t.Status = StatusAdded
+			if old, ok := moved[name]; ok && !cs.existsAfter(path.Join(ix.relPath, old)) {
+				t.Status = StatusRenamed
+				t.OldName = old
+			}
+		case before:
+			t.Status = StatusDeleted
+		default:
+			// Neither side has it (e.g. only ignored files); nothing to act on.
+			delete(found, name)
+			delete(explain, name)
+		}
+	}
+
+	// The old side of a rename is reported through the renamed target.
+	for _, t := range found {
+		if t.Status == StatusRenamed {
+			if old, ok := found[t.OldName]; ok && old.Status == StatusDeleted {
+				explain[t.Name].Files = append(explain[t.OldName].Files, explain[t.Name].Files...)
+				delete(found, t.OldName)
+				delete(explain, t.OldName)
+			}
+		}
+	}
+}
+
+// filterIgnored drops the files matched by repo-relative ignore patterns.
+func filterIgnored(files, patterns []string) []string {
+	if len(patterns) == 0 {
+		return files
+	}
+	kept := make([]string, 0, len(files))
+	for _, f := range files {
+		if !utils.MatchIgnore(patterns, f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// targetFiles returns the changed files under targetPath, minus those matched
+// by the target's own .flowignore, whose patterns are relative to the target.
+func (cs *changeSet) targetFiles(targetPath string) ([]string, error) {
+	var patterns []string
+	if cs.targetIgnore {
+		var err error
+		patterns, err = utils.ReadPatternFile(filepath.Join(cs.root, filepath.FromSlash(targetPath), common.IgnoreFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %w", common.IgnoreFile, targetPath, err)
+		}
+	}
+
+	var files []string
+	for _, f := range cs.files {
+		if !strings.HasPrefix(f, targetPath+"/") {
+			continue
+		}
+		if !utils.MatchIgnore(patterns, strings.TrimPrefix(f, targetPath+"/")) {
+			files = append(files, f)
+		}
+	}
+	return files, nil
 }
@@ -0,0 +1,307 @@
+package get
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderEnv    = "env"
+	ProviderLocal  = "local"
+
+	// ProviderLastSuccess marks a base taken from the last successful workflow run.
+	ProviderLastSuccess = "last-success"
+)
+
+const (
+	FallbackMergeBase = "merge-base" // merge-base of head with the fallback branch
+	FallbackAll       = "all"        // report every target
+)
+
+// CIRefs is the base/head pair a CI job should diff, and how it was picked.
+type CIRefs struct {
+	Provider string `json:"provider"` // github|gitlab|env|local|last-success
+	Event    string `json:"event,omitempty"`
+	Base     string `json:"base"`
+	Head     string `json:"head"`
+	Note     string `json:"note,omitempty"` // why a fallback base was used
+}
+
+// WorkflowQuery selects the GitHub workflow runs to look at.
+type WorkflowQuery struct {
+	Owner    string
+	Repo     string
+	Workflow string // file name under .github/workflows, e.g. build.yaml
+	Branch   string
+	Token    string
+}
+
+// githubEvent holds the fields of a GitHub Actions event payload flow needs.
+type githubEvent struct {
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	Ref         string `json:"ref"`
+	Forced      bool   `json:"forced"`
+	PullRequest *struct {
+		Base struct {
+			SHA string `json:"sha"`
+		} `json:"base"`
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	MergeGroup *struct {
+		BaseSHA string `json:"base_sha"`
+		HeadSHA string `json:"head_sha"`
+	} `json:"merge_group"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// DetectCIRefs picks the base and head commits for the current CI run, both
+// resolved to SHAs. Explicit FLOW_BASE_REF/FLOW_HEAD_REF (or config
+// ci.base_ref/ci.head_ref) win, then the GitHub Actions event payload, then
+// GitLab CI variables. Outside CI, HEAD~1 and HEAD are used.
+//
+// A missing, all-zero or no longer reachable base (first push, force-push)
+// falls back to the merge-base with the default branch, or to
+// common.ZeroCommit so that every target is reported.
+func DetectCIRefs(projectRoot string) (*CIRefs, error) {
+	refs, err := detectCIRefs(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	if refs.Head, err = GetCommitSHA(projectRoot, refs.Head); err != nil {
+		return nil, fmt.Errorf("failed to resolve head: %w", err)
+	}
+	if refs.Base, err = GetCommitSHA(projectRoot, refs.Base); err != nil {
+		return nil, fmt.Errorf("failed to resolve base: %w", err)
+	}
+	return refs, nil
+}
+
+func detectCIRefs(projectRoot string) (*CIRefs, error) {
+	if base := utils.ResolveStringValue("", "ci.base_ref", "FLOW_BASE_REF"); base != "" {
+		head := utils.ResolveStringValue("", "ci.head_ref", "FLOW_HEAD_REF")
+		if head == "" {
+			head = "HEAD"
+		}
+		return &CIRefs{Provider: ProviderEnv, Base: base, Head: head}, nil
+	}
+
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return detectGitHubRefs(projectRoot)
+	case os.Getenv("GITLAB_CI") == "true":
+		return detectGitLabRefs(projectRoot)
+	}
+
+	return &CIRefs{Provider: ProviderLocal, Base: "HEAD~1", Head: "HEAD"}, nil
+}
+
+func detectGitHubRefs(projectRoot string) (*CIRefs, error) {
+	refs := &CIRefs{
+		Provider: ProviderGitHub,
+		Event:    os.Getenv("GITHUB_EVENT_NAME"),
+		Head:     os.Getenv("GITHUB_SHA"),
+	}
+	if refs.Head == "" {
+		refs.Head = "HEAD"
+	}
+
+	var ev githubEvent
+	if p := os.Getenv("GITHUB_EVENT_PATH"); p != "" {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GITHUB_EVENT_PATH: %w", err)
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, fmt.Errorf("failed to decode github event payload: %w", err)
+		}
+	}
+	defaultBranch := ev.Repository.DefaultBranch
+
+	switch refs.Event {
+	case "pull_request", "pull_request_target":
+		if ev.PullRequest == nil {
+			return nil, fmt.Errorf("%s event payload has no pull_request", refs.Event)
+		}
+		// actions/checkout fetches only the merge commit (GITHUB_SHA) by
+		// default, so the head SHA may not exist locally.
+		var notes []string
+		if head := ev.PullRequest.Head.SHA; head != "" && commitExists(projectRoot, head) {
+			refs.Head = head
+		} else {
+			notes = append(notes, fmt.Sprintf("pull request head %s not fetched, using %s", head, refs.Head))
+		}
+		// Diff from where the branch forked, not from the current base tip.
+		if mb, err := GetMergeBase(projectRoot, ev.PullRequest.Base.SHA, refs.Head); err == nil && mb != "" {
+			refs.Base = mb
+		} else {
+			refs.Base = ev.PullRequest.Base.SHA
+			notes = append(notes, "merge-base unavailable (shallow clone?), using the pull request base SHA")
+		}
+		refs.Note = strings.Join(notes, "; ")
+		return refs, nil
+
+	case "merge_group":
+		if ev.MergeGroup == nil {
+			return nil, fmt.Errorf("merge_group event payload has no merge_group")
+		}
+		refs.Base = ev.MergeGroup.BaseSHA
+		refs.Head = ev.MergeGroup.HeadSHA
+		return refs, nil
+
+	case "push":
+		if ev.After != "" {
+			refs.Head = ev.After
+		}
+		if strings.HasPrefix(ev.Ref, "refs/tags/") {
+			resolveTagBase(projectRoot, refs)
+			return refs, nil
+		}
+		resolvePushBase(projectRoot, refs, ev.Before, ev.Forced, defaultBranch)
+		return refs, nil
+	}
+
+	// schedule, workflow_dispatch, ...: compare with the previous commit.
+	refs.Base = refs.Head + "~1"
+	return refs, nil
+}
+
+func detectGitLabRefs(projectRoot string) (*CIRefs, error) {
+	refs := &CIRefs{
+		Provider: ProviderGitLab,
+		Event:    os.Getenv("CI_PIPELINE_SOURCE"),
+		Head:     os.Getenv("CI_COMMIT_SHA"),
+	}
+	if refs.Head == "" {
+		refs.Head = "HEAD"
+	}
+
+	switch {
+	case os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA") != "":
+		refs.Base = os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA")
+	case os.Getenv("CI_COMMIT_TAG") != "":
+		resolveTagBase(projectRoot, refs)
+	default:
+		resolvePushBase(projectRoot, refs, os.Getenv("CI_COMMIT_BEFORE_SHA"), false, os.Getenv("CI_DEFAULT_BRANCH"))
+	}
+	return refs, nil
+}
+
+// resolvePushBase uses before as the base when it is a usable ancestor of
+// refs.Head and falls back to the default branch merge-base otherwise.
+func resolvePushBase(projectRoot string, refs *CIRefs, before string, forced bool, defaultBranch string) {
+	if before != "" && before != common.ZeroCommit && commitExists(projectRoot, before) {
+		if ok, err := IsAncestor(projectRoot, before, refs.Head); err == nil && ok {
+			refs.Base = before
+			return
+		}
+		if mb, err := GetMergeBase(projectRoot, before, refs.Head); err == nil && mb != "" {
+			refs.Base = mb
+			refs.Note = "previous head is not an ancestor (force-push), using its merge-base"
+			return
+		}
+	}
+
+	switch {
+	case before == "" || before == common.ZeroCommit:
+		refs.Note = "no previous head (first push of the branch)"
+	case forced:
+		refs.Note = "previous head unreachable after force-push"
+	default:
+		refs.Note = "previous head not found (shallow clone?)"
+	}
+
+	if defaultBranch != "" {
+		for _, candidate := range []string{"origin/" + defaultBranch, defaultBranch} {
+			if mb, err := GetMergeBase(projectRoot, candidate, refs.Head); err == nil && mb != "" && mb != refs.Head {
+				refs.Base = mb
+				refs.Note += fmt.Sprintf(", using merge-base with %s", candidate)
+				return
+			}
+		}
+	}
+
+	refs.Base = common.ZeroCommit
+	refs.Note += ", reporting every target"
+}
+
+// resolveTagBase uses the previous tag reachable from refs.Head as the base.
+func resolveTagBase(projectRoot string, refs *CIRefs) {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "describe", "--tags", "--abbrev=0", refs.Head+"^").Output()
+	if err == nil && strings.TrimSpace(string(out)) != "" {
+		refs.Base = strings.TrimSpace(string(out))
+		return
+	}
+	refs.Base = common.ZeroCommit
+	refs.Note = "no previous tag, reporting every target"
+}
+
+func commitExists(projectRoot, sha string) bool {
+	return runner.Command(runner.Context(), "git", "-C", projectRoot, "cat-file", "-e", sha+"^{commit}").Run() == nil
+}
+
+// ResolveLastSuccessRefs uses the head SHA of the last successful run of the
+// queried workflow as the base for head, as long as that SHA is still known
+// locally and an ancestor of head (force-pushes can orphan it). Otherwise it
+// falls back to the merge-base of head with fallbackBranch (FallbackMergeBase)
+// or to common.ZeroCommit so that every target is reported (FallbackAll).
+func ResolveLastSuccessRefs(projectRoot, head string, q WorkflowQuery, fallback, fallbackBranch string) (*CIRefs, error) {
+	headSHA, err := GetCommitSHA(projectRoot, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve head: %w", err)
+	}
+	refs := &CIRefs{Provider: ProviderLastSuccess, Head: headSHA}
+
+	run, err := GetLastSuccessfulRun(q.Owner, q.Repo, q.Workflow, q.Branch, q.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch last successful run: %w", err)
+	}
+
+	switch {
+	case run == nil:
+		refs.Note = fmt.Sprintf("no successful %s run on %s", q.Workflow, q.Branch)
+	case !commitExists(projectRoot, run.HeadSHA):
+		refs.Note = fmt.Sprintf("last successful run %s is not in local history (shallow clone?)", Shorten(run.HeadSHA, 7))
+	default:
+		ok, err := IsAncestor(projectRoot, run.HeadSHA, headSHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check ancestry of %s: %w", run.HeadSHA, err)
+		}
+		if ok {
+			refs.Base = run.HeadSHA
+			return refs, nil
+		}
+		refs.Note = fmt.Sprintf("last successful run %s is not an ancestor of head (force-push?)", Shorten(run.HeadSHA, 7))
+	}
+
+	switch fallback {
+	case FallbackAll:
+	case FallbackMergeBase:
+		for _, candidate := range []string{"origin/" + fallbackBranch, fallbackBranch} {
+			if mb, err := GetMergeBase(projectRoot, candidate, headSHA); err == nil && mb != "" {
+				refs.Base = mb
+				refs.Note += fmt.Sprintf(", using merge-base with %s", candidate)
+				return refs, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid fallback: %q (expected: %s|%s)", fallback, FallbackMergeBase, FallbackAll)
+	}
+
+	refs.Base = common.ZeroCommit
+	refs.Note += ", reporting every target"
+	return refs, nil
+}
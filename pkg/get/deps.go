@@ -0,0 +1,382 @@
+package get
+
+import (
+	"bufio"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goModule is an in-repo Go module discovered from a go.mod file.
+type goModule struct {
+	Path     string            // module path declared in go.mod
+	Go       string            // go directive, e.g. 1.24.5
+	Dir      string            // repo-relative directory holding go.mod
+	Replaces map[string]string // module path → repo-relative dir, local replaces only
+}
+
+// GoDeps is the set of in-repo paths a Go target depends on.
+type GoDeps struct {
+	Dirs  map[string]struct{} // repo-relative package dirs (target's own included)
+	Files map[string]struct{} // repo-relative go.mod/go.sum/go.work files
+}
+
+// GoDepResolver resolves the in-repo import and module graph of Go targets.
+// Parsed modules and package imports are cached, so a single resolver can be
+// shared across every target of a run.
+type GoDepResolver struct {
+	root    string
+	modules map[string]*goModule // keyed by repo-relative dir
+	work    []string             // repo-relative dirs from go.work `use`
+	imports map[string][]string  // package dir → imports
+}
+
+// NewGoDepResolver scans projectRoot for go.mod and go.work files.
+func NewGoDepResolver(projectRoot string) (*GoDepResolver, error) {
+	r := &GoDepResolver{
+		root:    projectRoot,
+		modules: make(map[string]*goModule),
+		imports: make(map[string][]string),
+	}
+
+	err := filepath.WalkDir(projectRoot, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != projectRoot && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		rel, err := r.rel(filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		mod, err := parseGoMod(p, rel)
+		if err != nil {
+			return err
+		}
+		if mod.Path != "" {
+			r.modules[rel] = mod
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	work, err := parseGoWork(filepath.Join(projectRoot, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	r.work = work
+
+	return r, nil
+}
+
+// Resolve returns the transitive in-repo dependencies of the Go target at
+// targetRelDir. It returns nil when the target does not belong to a Go module.
+func (r *GoDepResolver) Resolve(targetRelDir string) (*GoDeps, error) {
+	targetRelDir = path.Clean(filepath.ToSlash(targetRelDir))
+
+	owner := r.owningModule(targetRelDir)
+	if owner == nil {
+		return nil, nil
+	}
+
+	// Modules whose import paths resolve to in-repo dirs for this target.
+	visible := map[string]string{owner.Path: owner.Dir}
+	for modPath, dir := range owner.Replaces {
+		visible[modPath] = dir
+	}
+	inWorkspace := false
+	for _, dir := range r.work {
+		if dir == owner.Dir {
+			inWorkspace = true
+		}
+	}
+	if inWorkspace {
+		for _, dir := range r.work {
+			if mod, ok := r.modules[dir]; ok {
+				visible[mod.Path] = mod.Dir
+			}
+		}
+	}
+
+	deps := &GoDeps{
+		Dirs:  make(map[string]struct{}),
+		Files: make(map[string]struct{}),
+	}
+	if inWorkspace {
+		deps.Files["go.work"] = struct{}{}
+		deps.Files["go.work.sum"] = struct{}{}
+	}
+
+	// Seed with every package inside the target itself.
+	var queue []string
+	err := filepath.WalkDir(filepath.Join(r.root, filepath.FromSlash(targetRelDir)), func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := r.rel(p)
+		if err != nil {
+			return err
+		}
+		if rel != targetRelDir {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" {
+				return filepath.SkipDir
+			}
+			if _, nested := r.modules[rel]; nested {
+				return filepath.SkipDir
+			}
+		}
+		queue = append(queue, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if _, ok := deps.Dirs[dir]; ok {
+			continue
+		}
+		deps.Dirs[dir] = struct{}{}
+
+		if mod := r.owningModule(dir); mod != nil {
+			deps.Files[path.Join(mod.Dir, "go.mod")] = struct{}{}
+			deps.Files[path.Join(mod.Dir, "go.sum")] = struct{}{}
+		}
+
+		imports, err := r.packageImports(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range imports {
+			if depDir, ok := resolveImport(visible, imp); ok {
+				if _, seen := deps.Dirs[depDir]; !seen {
+					queue = append(queue, depDir)
+				}
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// owningModule returns the module whose go.mod is the nearest ancestor of dir.
+func (r *GoDepResolver) owningModule(dir string) *goModule {
+	for {
+		if mod, ok := r.modules[dir]; ok {
+			return mod
+		}
+		if dir == "." || dir == "" {
+			return nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// packageImports returns the imports of the non-test .go files in dir.
+func (r *GoDepResolver) packageImports(dir string) ([]string, error) {
+	if imports, ok := r.imports[dir]; ok {
+		return imports, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.root, filepath.FromSlash(dir)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.imports[dir] = nil
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var imports []string
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(r.root, filepath.FromSlash(dir), name), nil, parser.ImportsOnly)
+		if err != nil {
+			// A file that doesn't parse still belongs to the package; skip its imports.
+			continue
+		}
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if _, ok := seen[imp]; ok {
+				continue
+			}
+			seen[imp] = struct{}{}
+			imports = append(imports, imp)
+		}
+	}
+
+	r.imports[dir] = imports
+	return imports, nil
+}
+
+func (r *GoDepResolver) rel(p string) (string, error) {
+	rel, err := filepath.Rel(r.root, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// resolveImport maps an import path to a repo-relative dir using the longest
+// matching visible module path.
+func resolveImport(visible map[string]string, imp string) (string, bool) {
+	best := ""
+	for modPath := range visible {
+		if (imp == modPath || strings.HasPrefix(imp, modPath+"/")) && len(modPath) > len(best) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return path.Join(visible[best], strings.TrimPrefix(imp, best)), true
+}
+
+// GoModule is the module path and go version declared by a go.mod.
+type GoModule struct {
+	Path      string `json:"path" yaml:"path"`
+	GoVersion string `json:"go_version,omitempty" yaml:"go_version,omitempty"`
+}
+
+// FindGoModule returns the module owning dir: the go.mod in dir or in its
+// closest parent up to projectRoot. It returns nil when no module owns dir.
+func FindGoModule(projectRoot, dir string) (*GoModule, error) {
+	for {
+		goMod := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(goMod); err == nil {
+			mod, err := parseGoMod(goMod, "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", goMod, err)
+			}
+			return &GoModule{Path: mod.Path, GoVersion: mod.Go}, nil
+		}
+		if dir == projectRoot || dir == filepath.Dir(dir) {
+			return nil, nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// parseGoMod reads the module path and local replace directives of a go.mod.
+func parseGoMod(goModPath, relDir string) (*goModule, error) {
+	mod := &goModule{Dir: relDir, Replaces: make(map[string]string)}
+
+	err := scanGoDirectives(goModPath, func(verb string, fields []string) {
+		switch verb {
+		case "module":
+			if len(fields) > 0 {
+				mod.Path = strings.Trim(fields[0], `"`)
+			}
+		case "go":
+			if len(fields) > 0 {
+				mod.Go = fields[0]
+			}
+		case "replace":
+			// old [version] => new [version]
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 1 || arrow+1 >= len(fields) {
+				return
+			}
+			target := strings.Trim(fields[arrow+1], `"`)
+			if !isLocalPath(target) {
+				return
+			}
+			mod.Replaces[strings.Trim(fields[0], `"`)] = path.Join(relDir, target)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mod, nil
+}
+
+// parseGoWork returns the repo-relative dirs listed by `use` in go.work.
+// A missing go.work yields no dirs.
+func parseGoWork(goWorkPath string) ([]string, error) {
+	var dirs []string
+	err := scanGoDirectives(goWorkPath, func(verb string, fields []string) {
+		if verb == "use" && len(fields) > 0 {
+			dirs = append(dirs, path.Clean(strings.Trim(fields[0], `"`)))
+		}
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return dirs, err
+}
+
+// scanGoDirectives walks go.mod/go.work style files and calls fn for every
+// directive, expanding `verb ( ... )` blocks into one call per line.
+func scanGoDirectives(filePath string, fn func(verb string, fields []string)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	block := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fn(block, fields)
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		fn(fields[0], fields[1:])
+	}
+	return sc.Err()
+}
+
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || p == "." || p == ".."
+}
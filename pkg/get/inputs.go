@@ -0,0 +1,42 @@
+package get
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/selimacerbas/flow/internal/cache"
+	"github.com/selimacerbas/flow/internal/common"
+)
+
+// TargetInputs returns the cache inputs of t: its whole dir and, for Go
+// targets, the in-repo packages and go.mod/go.sum/go.work files it depends on.
+// Callers add the env, tools and outputs specific to their operation.
+func TargetInputs(r *GoDepResolver, t common.Target) (cache.Inputs, error) {
+	rel, err := filepath.Rel(r.root, t.Dir)
+	if err != nil {
+		return cache.Inputs{}, err
+	}
+	rel = filepath.ToSlash(rel)
+	in := cache.Inputs{Root: r.root, Trees: []string{rel}}
+
+	deps, err := r.Resolve(rel)
+	if err != nil {
+		return cache.Inputs{}, fmt.Errorf("failed to resolve go dependencies of %s: %w", t.ID(), err)
+	}
+	if deps == nil {
+		return in, nil
+	}
+	for dir := range deps.Dirs {
+		if dir != rel && !strings.HasPrefix(dir, rel+"/") {
+			in.Dirs = append(in.Dirs, dir)
+		}
+	}
+	for f := range deps.Files {
+		in.Files = append(in.Files, f)
+	}
+	sort.Strings(in.Dirs)
+	sort.Strings(in.Files)
+	return in, nil
+}
@@ -1,20 +1,23 @@
 package get
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"os/exec"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
 )
 
 func GetCommitSHA(repoRoot, ref string) (string, error) {
+	// An all-zero SHA (e.g. GitHub's `before` on a first push) has no commit behind it.
+	if ref == common.ZeroCommit {
+		return common.ZeroCommit, nil
+	}
+
 	var tildeRe = regexp.MustCompile(`^(.*)~(\d+)$`)
 	// Handle "...~N" safely.
 	if m := tildeRe.FindStringSubmatch(ref); m != nil {
@@ -25,7 +28,7 @@ func GetCommitSHA(repoRoot, ref string) (string, error) {
 		n, _ := strconv.Atoi(m[2])
 
 		// Resolve base to a commit (handles annotated tags).
-		baseOut, err := exec.Command("git", "-C", repoRoot, "rev-parse", "--verify", base+"^{commit}").Output()
+		baseOut, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "rev-parse", "--verify", base+"^{commit}").Output()
 		if err != nil {
 			return "", fmt.Errorf("resolve base %q: %w", base, err)
 		}
@@ -36,7 +39,7 @@ func GetCommitSHA(repoRoot, ref string) (string, error) {
 
 		// Walk N first-parent steps; if we run out of parents → ZeroCommit.
 		for i := 0; i < n; i++ {
-			parOut, err := exec.Command("git", "-C", repoRoot, "show", "-s", "--format=%P", cur).Output()
+			parOut, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "show", "-s", "--format=%P", cur).Output()
 			if err != nil {
 				// Don’t pretend this is root; surface the error (e.g., shallow history).
 				return "", fmt.Errorf("read parents of %s: %w", cur, err)
@@ -50,7 +53,7 @@ func GetCommitSHA(repoRoot, ref string) (string, error) {
 		}
 
 		// There are at least N ancestors → resolve the original ref normally.
-		out, err := exec.Command("git", "-C", repoRoot, "rev-parse", "--verify", ref+"^{commit}").Output()
+		out, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "rev-parse", "--verify", ref+"^{commit}").Output()
 		if err != nil {
 			return "", fmt.Errorf("rev-parse %q: %w", ref, err)
 		}
@@ -62,7 +65,7 @@ func GetCommitSHA(repoRoot, ref string) (string, error) {
 	}
 
 	// Normal path: resolve any ref/expr to a commit.
-	out, err := exec.Command("git", "-C", repoRoot, "rev-parse", "--verify", ref+"^{commit}").Output()
+	out, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "rev-parse", "--verify", ref+"^{commit}").Output()
 	if err != nil {
 		return "", fmt.Errorf("rev-parse %q: %w", ref, err)
 	}
@@ -73,16 +76,39 @@ func GetCommitSHA(repoRoot, ref string) (string, error) {
 	return sha, nil
 }
 
+// Describe returns `git describe --tags --always --dirty` of HEAD, e.g.
+// v1.4.0-3-g1a2b3c4-dirty.
+func Describe(repoRoot string) (string, error) {
+	out, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "describe", "--tags", "--always", "--dirty").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // MergeBase returns `git merge-base ref branch`.
 func GetMergeBase(repoRoot, ref, branch string) (string, error) {
 	ref = strings.TrimSpace(ref)
-	out, err := exec.Command("git", "-C", repoRoot, "merge-base", ref, branch).Output()
+	out, err := runner.Command(runner.Context(), "git", "-C", repoRoot, "merge-base", ref, branch).Output()
 	if err != nil {
 		return "", err
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
+// IsAncestor reports whether ancestor is reachable from descendant.
+func IsAncestor(repoRoot, ancestor, descendant string) (bool, error) {
+	err := runner.Command(runner.Context(), "git", "-C", repoRoot, "merge-base", "--is-ancestor", ancestor, descendant).Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
 // Shorten returns the first n chars of a SHA (or the input if shorter).
 func Shorten(sha string, n int) string {
 	if n <= 0 {
@@ -94,41 +120,180 @@ func Shorten(sha string, n int) string {
 	return sha[:n]
 }
 
-func GetChangedDirs(projectRoot, relPath, ref1, ref2 string) ([]string, error) {
-	out, err := exec.Command("git", "-C", projectRoot, "diff", "--name-only", ref1, ref2).Output()
+// FileChange is a single entry of a rename-aware git diff.
+type FileChange struct {
+	Status  string // A, M, D, R, C or T
+	Path    string // repo-relative path on the ref2 side (ref1 side for deletions)
+	OldPath string // repo-relative path on the ref1 side of renames and copies
+}
+
+// GetFileChanges returns `git diff --name-status -M` between ref1 and ref2.
+func GetFileChanges(projectRoot, ref1, ref2 string) ([]FileChange, error) {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "diff", "--name-status", "-M", "-z", ref1, ref2).Output()
 	if err != nil {
 		return nil, err
 	}
+	return parseNameStatus(out)
+}
 
-	seen := make(map[string]struct{})
-	var dirs []string
+// ChangedLines maps repo-relative paths to the line ranges added or modified
+// on the ref2 side of a diff.
+type ChangedLines map[string][]LineRange
 
-	sc := bufio.NewScanner(bytes.NewReader(out))
-	for sc.Scan() {
-		p := sc.Text()
-		if !strings.HasPrefix(p, relPath+"/") {
-			continue
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start, End int
+}
+
+// Contains reports whether line of file was added or modified.
+func (c ChangedLines) Contains(file string, line int) bool {
+	for _, r := range c[file] {
+		if line >= r.Start && line <= r.End {
+			return true
 		}
+	}
+	return false
+}
 
-		trimmed := strings.TrimPrefix(p, relPath+"/")
+// GetChangedLines returns the lines changed between ref1 and ref2, from a
+// rename-aware diff without context lines. --no-prefix keeps the file names
+// independent of the user's diff.noprefix and diff.mnemonicPrefix settings.
+func GetChangedLines(projectRoot, ref1, ref2 string) (ChangedLines, error) {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "diff", "-U0", "-M", "--no-color", "--no-ext-diff", "--no-prefix", ref1, ref2).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseUnifiedHunks(out)
+}
 
-		// If there's no '/' left, it's a file directly under relPath (e.g. README.md) → skip
-		slash := strings.IndexByte(trimmed, '/')
-		if slash == -1 {
-			continue
+// parseUnifiedHunks reads the new-side ranges of `@@ -a,b +c,d @@` headers.
+func parseUnifiedHunks(out []byte) (ChangedLines, error) {
+	lines := make(ChangedLines)
+	file := ""
+	for _, l := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(l, "+++ "):
+			name := strings.TrimPrefix(l, "+++ ")
+			if unquoted, err := strconv.Unquote(name); err == nil {
+				name = unquoted // git quotes paths with special chars
+			}
+			file = ""
+			if name != "/dev/null" { // deleted: nothing to report on
+				file = name
+			}
+		case strings.HasPrefix(l, "@@ ") && file != "":
+			fields := strings.Fields(l)
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+				return nil, fmt.Errorf("malformed hunk header %q", l)
+			}
+			startStr, countStr, hasCount := strings.Cut(fields[2][1:], ",")
+			start, err := strconv.Atoi(startStr)
+			if err != nil {
+				return nil, fmt.Errorf("malformed hunk header %q", l)
+			}
+			count := 1
+			if hasCount {
+				if count, err = strconv.Atoi(countStr); err != nil {
+					return nil, fmt.Errorf("malformed hunk header %q", l)
+				}
+			}
+			if count > 0 { // 0 is a pure deletion
+				lines[file] = append(lines[file], LineRange{Start: start, End: start + count - 1})
+			}
 		}
+	}
+	return lines, nil
+}
+
+// parseNameStatus parses NUL-separated `--name-status -z` output.
+func parseNameStatus(out []byte) ([]FileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
 
-		top := trimmed[:slash]
-		if _, ok := seen[top]; ok {
+	var changes []FileChange
+	for i := 0; i < len(fields); {
+		status := fields[i]
+		if status == "" {
+			return nil, errors.New("malformed diff output: empty status")
+		}
+		// R and C carry a similarity score (e.g. R087) followed by old and new paths.
+		if status[0] == 'R' || status[0] == 'C' {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("malformed diff output after %q", status)
+			}
+			changes = append(changes, FileChange{Status: status[:1], OldPath: fields[i+1], Path: fields[i+2]})
+			i += 3
 			continue
 		}
-		seen[top] = struct{}{}
-		dirs = append(dirs, top)
+		if i+1 >= len(fields) {
+			return nil, fmt.Errorf("malformed diff output after %q", status)
+		}
+		changes = append(changes, FileChange{Status: status[:1], Path: fields[i+1]})
+		i += 2
 	}
-	if err := sc.Err(); err != nil {
+	return changes, nil
+}
+
+// GetLocalFileChanges returns the rename-aware diff between ref and the index
+// (staged) or the working tree (staged and unstaged edits).
+func GetLocalFileChanges(projectRoot, ref string, staged bool) ([]FileChange, error) {
+	args := []string{"-C", projectRoot, "diff", "--name-status", "-M", "-z"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	out, err := runner.Command(runner.Context(), "git", append(args, ref)...).Output()
+	if err != nil {
 		return nil, err
 	}
+	return parseNameStatus(out)
+}
+
+// GetUntrackedFiles returns untracked files that are not excluded by .gitignore.
+func GetUntrackedFiles(projectRoot string) ([]string, error) {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "ls-files", "--others", "--exclude-standard", "-z").Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// PathExistsInIndex reports whether the index tracks relPath or anything below it.
+func PathExistsInIndex(projectRoot, relPath string) bool {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "ls-files", "-z", "--", relPath).Output()
+	return err == nil && len(out) > 0
+}
+
+// ChangedPaths flattens changes into repo-relative paths, including the old
+// side of renames so both source and destination count as changed.
+func ChangedPaths(changes []FileChange) []string {
+	paths := make([]string, 0, len(changes))
+	for _, c := range changes {
+		if c.Status == "R" {
+			paths = append(paths, c.OldPath)
+		}
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// GetChangedFiles returns the repo-relative paths that differ between ref1 and ref2.
+func GetChangedFiles(projectRoot, ref1, ref2 string) ([]string, error) {
+	changes, err := GetFileChanges(projectRoot, ref1, ref2)
+	if err != nil {
+		return nil, err
+	}
+	return ChangedPaths(changes), nil
+}
 
-	sort.Strings(dirs) // stable output
-	return dirs, nil
+// PathExistsAtRef reports whether relPath exists in the tree of ref.
+func PathExistsAtRef(projectRoot, ref, relPath string) bool {
+	return runner.Command(runner.Context(), "git", "-C", projectRoot, "cat-file", "-e", ref+":"+relPath).Run() == nil
 }
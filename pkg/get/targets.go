@@ -0,0 +1,134 @@
+package get
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// targetIndex maps repo-relative paths to the targets of one kind. Target
+// names are paths relative to the kind root, e.g. payments/ledger-api.
+type targetIndex struct {
+	relPath   string // kind root, slash-separated and repo-relative
+	discovery utils.TargetDiscovery
+	known     []string // marker-based targets on either side of the diff
+	onDisk    []string // targets present in the working tree, sorted
+}
+
+// newTargetIndex discovers the targets of kind in the working tree. With
+// markers, targets are also picked up from marker files in the tree of ref
+// and among changed, so that added and deleted targets are recognized too.
+func newTargetIndex(root, ref string, kind common.Kind, changed []string) (*targetIndex, error) {
+	ix := &targetIndex{relPath: filepath.ToSlash(kind.Path), discovery: kind.Discovery()}
+
+	kindRoot := filepath.Join(root, kind.Path)
+	dirs, err := utils.DiscoverTargetDirs(kindRoot, ix.discovery)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(kindRoot, dir)
+		if err != nil {
+			return nil, err
+		}
+		ix.onDisk = append(ix.onDisk, filepath.ToSlash(rel))
+	}
+
+	if len(ix.discovery.Markers) == 0 {
+		return ix, nil
+	}
+
+	files, err := listTreeFiles(root, ref, ix.relPath)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, changed...)
+
+	var rel []string
+	for _, f := range files {
+		if strings.HasPrefix(f, ix.relPath+"/") {
+			rel = append(rel, strings.TrimPrefix(f, ix.relPath+"/"))
+		}
+	}
+	known := append(utils.TargetDirsFromFiles(rel, ix.discovery), ix.onDisk...)
+	sort.Strings(known)
+	ix.known = utils.OutermostDirs(dedupeSorted(known))
+	return ix, nil
+}
+
+// targetOf returns the name of the target that p lies in, if any.
+func (ix *targetIndex) targetOf(p string) (string, bool) {
+	if !strings.HasPrefix(p, ix.relPath+"/") {
+		return "", false
+	}
+	trimmed := strings.TrimPrefix(p, ix.relPath+"/")
+
+	if len(ix.discovery.Markers) == 0 {
+		// Targets are the dirs at a fixed depth.
+		depth := ix.discovery.MaxDepth()
+		segs := strings.Split(trimmed, "/")
+		if len(segs) <= depth {
+			return "", false
+		}
+		return strings.Join(segs[:depth], "/"), true
+	}
+
+	for dir := path.Dir(trimmed); dir != "."; dir = path.Dir(dir) {
+		i := sort.SearchStrings(ix.known, dir)
+		if i < len(ix.known) && ix.known[i] == dir {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// targetsOf returns the sorted, unique targets that files lie in.
+func (ix *targetIndex) targetsOf(files []string) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, f := range files {
+		name, ok := ix.targetOf(f)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listTreeFiles returns the files under relPath in the tree of ref.
+func listTreeFiles(projectRoot, ref, relPath string) ([]string, error) {
+	out, err := runner.Command(runner.Context(), "git", "-C", projectRoot, "ls-tree", "-r", "-z", "--name-only", ref, "--", relPath).Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func dedupeSorted(sorted []string) []string {
+	var out []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package get
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/selimacerbas/flow/internal/runner"
+	"github.com/selimacerbas/flow/internal/utils"
+)
+
+// GetLastSuccessfulRun returns the latest successful run of workflow on branch,
+// or nil when there is none. It prefers the REST API when a token is given,
+// then the local gh CLI (user's gh auth), then unauthenticated HTTP.
+func GetLastSuccessfulRun(owner, repo, workflow, branch, token string) (*WorkflowRun, error) {
+	switch {
+	case token != "":
+		// Prefer HTTP when we have a token (works in CI & private repos)
+		return fetchRunHTTP(owner, repo, workflow, branch, token)
+	case utils.HasBin("gh"):
+		// Otherwise, try local gh CLI (uses user's gh auth & host config).
+		return fetchRunViaGH(owner, repo, workflow, branch)
+	default:
+		// As a last resort, try unauthenticated HTTP (public repos only).
+		return fetchRunHTTP(owner, repo, workflow, branch, "")
+	}
+}
+
+// WorkflowRun is a GitHub Actions workflow run as returned by the REST API.
+type WorkflowRun struct {
+	ID         int64     `json:"id"`
+	HeadSHA    string    `json:"head_sha"`
+	RunNumber  int       `json:"run_number"`
+	RunAttempt int       `json:"run_attempt"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	Event      string    `json:"event"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	HTMLURL    string    `json:"html_url"`
+}
+
+type ghListResp struct {
+	Runs []WorkflowRun `json:"workflow_runs"`
+}
+
+func fetchRunHTTP(owner, repo, workflow, branch, token string) (*WorkflowRun, error) {
+	u := fmt.Sprintf(
+		"https://api.github.com/repos/%s/%s/actions/workflows/%s/runs?branch=%s&status=success&exclude_pull_requests=true&per_page=1",
+		url.PathEscape(owner),
+		url.PathEscape(repo),
+		url.PathEscape(workflow),
+		url.QueryEscape(branch),
+	)
+
+	req, _ := http.NewRequest("GET", u, nil)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("github api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Note: private repos without token intentionally return 404
+		return nil, fmt.Errorf("github api: %s (check owner/repo/workflow name/token)", resp.Status)
+	}
+
+	var out ghListResp
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode github response: %w", err)
+	}
+	if len(out.Runs) == 0 {
+		return nil, nil
+	}
+	return &out.Runs[0], nil
+}
+
+func fetchRunViaGH(owner, repo, workflow, branch string) (*WorkflowRun, error) {
+	args := []string{
+		"api",
+		fmt.Sprintf("repos/%s/%s/actions/workflows/%s/runs", owner, repo, workflow),
+		"--method", "GET", // keep it GET; otherwise -f/-F would POST and 404
+		"-H", "X-GitHub-Api-Version: 2022-11-28",
+		"-F", "branch=" + branch,
+		"-F", "status=success",
+		"-F", "exclude_pull_requests=true",
+		"-F", "per_page=1",
+	}
+	cmd := runner.Command(runner.Context(), "gh", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gh api failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var out ghListResp
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("decode gh api response: %w", err)
+	}
+	if len(out.Runs) == 0 {
+		return nil, nil
+	}
+	return &out.Runs[0], nil
+}
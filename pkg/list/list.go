@@ -0,0 +1,111 @@
+package list
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/internal/utils"
+	"github.com/selimacerbas/flow/pkg/get"
+)
+
+// TargetInfo is the inventory entry of a single target.
+type TargetInfo struct {
+	Name        string            `json:"name" yaml:"name"`
+	Kind        string            `json:"kind" yaml:"kind"`
+	Path        string            `json:"path" yaml:"path"` // repo-relative target dir
+	Language    string            `json:"language,omitempty" yaml:"language,omitempty"`
+	GoModule    string            `json:"go_module,omitempty" yaml:"go_module,omitempty"`
+	GoVersion   string            `json:"go_version,omitempty" yaml:"go_version,omitempty"`
+	Dockerfile  bool              `json:"dockerfile" yaml:"dockerfile"`
+	CloudBuild  bool              `json:"cloudbuild" yaml:"cloudbuild"`
+	Manifest    bool              `json:"manifest" yaml:"manifest"` // has a flow.target.yaml
+	BuildMethod string            `json:"build_method,omitempty" yaml:"build_method,omitempty"`
+	Image       string            `json:"image,omitempty" yaml:"image,omitempty"` // resolved image reference
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ListTargets discovers every target of the kinds selected by scope whose
+// labels match selector, in kind order, and describes each with what flow
+// knows or infers about it.
+func ListTargets(scope, selector, srcDir, funcSub, svcSub string) ([]TargetInfo, error) {
+	root, err := utils.DetectProjectRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect project root: %w", err)
+	}
+
+	kinds, err := common.ResolveScopeKinds(scope, srcDir, funcSub, svcSub)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := common.ResolveImageSettings(common.ImageSettings{})
+	infos := []TargetInfo{}
+	for _, k := range kinds {
+		targets, err := common.ResolveKindTargets(root, []common.Kind{k}, nil)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // kind root not created yet
+			}
+			return nil, fmt.Errorf("failed to discover %s targets: %w", k.Name, err)
+		}
+		if targets, err = common.FilterTargets(targets, selector); err != nil {
+			return nil, err
+		}
+
+		for _, t := range targets {
+			info, err := describe(root, t, settings)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func describe(root string, t common.Target, settings common.ImageSettings) (TargetInfo, error) {
+	rel, err := filepath.Rel(root, t.Dir)
+	if err != nil {
+		return TargetInfo{}, err
+	}
+
+	method := settings.MethodFor(t)
+	info := TargetInfo{
+		Name:        t.Name,
+		Kind:        t.Kind,
+		Path:        filepath.ToSlash(rel),
+		Language:    t.Language(),
+		Dockerfile:  exists(filepath.Join(t.Dir, "Dockerfile")),
+		Manifest:    t.Manifest != nil,
+		BuildMethod: method,
+		Image:       settings.ImageReference(t, method),
+		Labels:      t.Labels,
+	}
+
+	cloudBuild := "cloudbuild.yaml"
+	if t.Manifest != nil && t.Manifest.Build.CloudBuildConfig != "" {
+		cloudBuild = t.Manifest.Build.CloudBuildConfig
+	}
+	info.CloudBuild = exists(filepath.Join(t.Dir, cloudBuild))
+
+	if info.Language == "go" {
+		mod, err := get.FindGoModule(root, t.Dir)
+		if err != nil {
+			return TargetInfo{}, err
+		}
+		if mod != nil {
+			info.GoModule = mod.Path
+			info.GoVersion = mod.GoVersion
+		}
+	}
+	return info, nil
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
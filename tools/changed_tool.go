@@ -9,27 +9,48 @@ import (
 )
 
 type ChangedToolArgs struct {
-	Ref1  string `json:"ref1" jsonschema:"The first git reference (branch, tag, ref, or sha)"`
-	Ref2  string `json:"ref2" jsonschema:"The second git reference (branch, tag, ref, or sha)"`
-	Scope string `json:"scope" jsonschema:"Kind to scan (function|service|all)."`
+	Ref1     string `json:"ref1,omitempty" jsonschema:"The first git reference (branch, tag, ref, or sha). Defaults to HEAD with staged, worktree or untracked."`
+	Ref2     string `json:"ref2,omitempty" jsonschema:"The second git reference (branch, tag, ref, or sha). Unused with staged, worktree or untracked."`
+	Scope    string `json:"scope" jsonschema:"Kind(s) to scan: a configured kind name, comma-separated names, or all."`
+	NoIgnore bool   `json:"no_ignore,omitempty" jsonschema:"Don't apply ignore config and .flowignore patterns."`
+	Explain  bool   `json:"explain,omitempty" jsonschema:"Include the rule and the changed files behind each target."`
+	Selector string `json:"selector,omitempty" jsonschema:"Kubernetes-style label selector, e.g. team=payments,tier!=experimental."`
+
+	Staged    bool `json:"staged,omitempty" jsonschema:"Compare ref1 (default HEAD) with the index."`
+	Worktree  bool `json:"worktree,omitempty" jsonschema:"Compare ref1 (default HEAD) with the working tree."`
+	Untracked bool `json:"untracked,omitempty" jsonschema:"Also count untracked files; implies worktree unless staged is set."`
 }
 
 type ChangedToolOutput struct {
-	Functions []string `json:"functions,omitempty"`
-	Services  []string `json:"services,omitempty"`
+	Kinds   map[string][]string           `json:"kinds" jsonschema:"Changed target names keyed by kind name."`
+	Targets map[string]*get.ChangedTarget `json:"targets,omitempty" jsonschema:"Status (added/modified/deleted/renamed) and reason of each changed target, keyed by <kind>/<name>."`
+	Explain map[string]*get.Explanation   `json:"explain,omitempty" jsonschema:"Rule (direct/dependency/global/watch) and triggering files per target, keyed by <kind>/<name>."`
 }
 
 // factory and closure function
 func ChangedTool(srcDir, funcSub, svcSub string) func(context.Context, *mcp.CallToolRequest, ChangedToolArgs) (*mcp.CallToolResult, any, error) {
 	return func(ctx context.Context, req *mcp.CallToolRequest, args ChangedToolArgs) (*mcp.CallToolResult, any, error) {
-		result, err := get.GetChanged(args.Ref1, args.Ref2, args.Scope, srcDir, funcSub, svcSub)
+		ref1 := args.Ref1
+		if ref1 == "" && (args.Staged || args.Worktree || args.Untracked) {
+			ref1 = "HEAD"
+		}
+		result, err := get.GetChanged(ref1, args.Ref2, args.Scope, srcDir, funcSub, svcSub, get.ChangedOptions{
+			NoIgnore:  args.NoIgnore,
+			Staged:    args.Staged,
+			Worktree:  args.Worktree,
+			Untracked: args.Untracked,
+			Selector:  args.Selector,
+		})
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to get changed: %w", err)
 		}
 
 		output := ChangedToolOutput{
-			Functions: result.Functions,
-			Services:  result.Services,
+			Kinds:   result.Kinds,
+			Targets: result.Targets,
+		}
+		if args.Explain {
+			output.Explain = result.Explain
 		}
 
 		return nil, output, nil
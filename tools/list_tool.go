@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/selimacerbas/flow/internal/common"
+	"github.com/selimacerbas/flow/pkg/list"
+)
+
+type ListToolArgs struct {
+	Kind     string `json:"kind,omitempty" jsonschema:"Kind(s) to list: a configured kind name, comma-separated names, or all (default)."`
+	Selector string `json:"selector,omitempty" jsonschema:"Kubernetes-style label selector, e.g. team=payments,tier!=experimental."`
+}
+
+type ListToolOutput struct {
+	Targets []list.TargetInfo `json:"targets" jsonschema:"Every discovered target with its kind, path, language, Go module, Dockerfile/cloudbuild.yaml presence and resolved image."`
+}
+
+// factory and closure function
+func ListTool(srcDir, funcSub, svcSub string) func(context.Context, *mcp.CallToolRequest, ListToolArgs) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args ListToolArgs) (*mcp.CallToolResult, any, error) {
+		kind := args.Kind
+		if kind == "" {
+			kind = common.ScopeAll
+		}
+		targets, err := list.ListTargets(kind, args.Selector, srcDir, funcSub, svcSub)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list targets: %w", err)
+		}
+		return nil, ListToolOutput{Targets: targets}, nil
+	}
+}